@@ -0,0 +1,550 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	accountObjectType      = "Account"
+	accountEntryObjectType = "AccountEntry"
+)
+
+// Account owner types
+const (
+	CustomerAccount = "Customer"
+	InsurerAccount  = "Insurer"
+	ExternalAccount = "External"
+)
+
+// externalAccountID is the clearing account for money entering or leaving the ledger
+const externalAccountID = "EXTERNAL"
+
+// reservedAccountPrefixes start the ids of accounts the contract opens itself
+var reservedAccountPrefixes = []string{"CUSTOMER-", "AGENT-", "INSURER-"}
+
+// Journal entry types
+const (
+	PremiumEntry    = "Premium"
+	RefundEntry     = "Refund"
+	ClaimEntry      = "Claim"
+	MaturityEntry   = "Maturity"
+	SurrenderEntry  = "Surrender"
+	WithdrawalEntry = "Withdrawal"
+	TransferEntry   = "Transfer"
+)
+
+// Account holds the balance of a customer, an insurer or the external clearing account
+type Account struct {
+	ID        string `json:"ID"`
+	OwnerType string `json:"OwnerType"`
+	OwnerName string `json:"OwnerName"`
+	// OwnerID is the client identity allowed to withdraw from and transfer out of a customer account.
+	// Accounts opened for payees without a known identity, such as beneficiaries, have none and are paid out by the insurer.
+	OwnerID   string  `json:"OwnerID"`
+	Balance   float64 `json:"Balance"`
+	CreatedAt string  `json:"CreatedAt"`
+}
+
+// JournalEntry is a double-entry posting moving Amount from the debited to the credited account
+type JournalEntry struct {
+	ID            string  `json:"ID"`
+	Type          string  `json:"Type"`
+	PolicyID      int     `json:"PolicyID"`
+	DebitAccount  string  `json:"DebitAccount"`
+	CreditAccount string  `json:"CreditAccount"`
+	Amount        float64 `json:"Amount"`
+	Description   string  `json:"Description"`
+	Timestamp     string  `json:"Timestamp"`
+}
+
+// StatementLine is one journal entry seen from an account, with a signed amount and the balance after it
+type StatementLine struct {
+	Entry          JournalEntry `json:"Entry"`
+	Amount         float64      `json:"Amount"`
+	RunningBalance float64      `json:"RunningBalance"`
+}
+
+// AccountStatement lists the entries of an account within a period with running balances
+type AccountStatement struct {
+	AccountID      string          `json:"AccountID"`
+	From           string          `json:"From"`
+	To             string          `json:"To"`
+	OpeningBalance float64         `json:"OpeningBalance"`
+	ClosingBalance float64         `json:"ClosingBalance"`
+	Lines          []StatementLine `json:"Lines"`
+}
+
+// accountRef identifies an account and who owns it, so it can be opened on first use
+type accountRef struct {
+	ID        string
+	OwnerType string
+	OwnerName string
+	OwnerID   string
+}
+
+// customerAccountRef returns the account receiving the payouts of a policy: the linked account, or else
+// the account of the holder's client identity, so holders sharing a name never share a balance
+func customerAccountRef(policy *Policy) accountRef {
+	id := policy.AccountID
+	if id == "" {
+		if policy.HolderID != "" {
+			id = fmt.Sprintf("CUSTOMER-%x", sha256.Sum256([]byte(policy.HolderID)))
+		} else {
+			// Policies issued before holders were recorded each get their own account
+			id = fmt.Sprintf("CUSTOMER-POLICY-%d", policy.ID)
+		}
+	}
+	return accountRef{ID: id, OwnerType: CustomerAccount, OwnerName: policy.HolderName, OwnerID: policy.HolderID}
+}
+
+func insurerAccountRef(companyName string) accountRef {
+	return accountRef{ID: "INSURER-" + companyName, OwnerType: InsurerAccount, OwnerName: companyName}
+}
+
+func externalAccountRef() accountRef {
+	return accountRef{ID: externalAccountID, OwnerType: ExternalAccount, OwnerName: "External"}
+}
+
+// journal collects postings of one transaction. Reads within a transaction do not see its own
+// writes, so balances are kept in memory and written once by commit.
+type journal struct {
+	ctx      contractapi.TransactionContextInterface
+	now      time.Time
+	accounts map[string]*Account
+	order    []string
+	entries  []JournalEntry
+	payouts  []pendingPayout
+}
+
+func newJournal(ctx contractapi.TransactionContextInterface) (*journal, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &journal{ctx: ctx, now: now, accounts: make(map[string]*Account)}, nil
+}
+
+// post moves amount from one account to another. Customer accounts cannot be overdrawn.
+func (j *journal) post(entryType string, policyID int, from accountRef, to accountRef, amount float64, description string) error {
+	if amount < 0 {
+		return fmt.Errorf("journal amount must not be negative")
+	}
+	if amount == 0 {
+		return nil
+	}
+
+	debit, err := j.account(from)
+	if err != nil {
+		return err
+	}
+	credit, err := j.account(to)
+	if err != nil {
+		return err
+	}
+
+	if debit.OwnerType == CustomerAccount && debit.Balance < amount {
+		return fmt.Errorf("insufficient balance in account %s", debit.ID)
+	}
+
+	debit.Balance -= amount
+	credit.Balance += amount
+
+	if isPayoutEntry(entryType) && credit.OwnerType == CustomerAccount {
+		j.payouts = append(j.payouts, pendingPayout{PolicyID: policyID, Account: to, EntryType: entryType, Amount: amount})
+	}
+
+	j.entries = append(j.entries, JournalEntry{
+		ID:            fmt.Sprintf("%s-%03d", j.ctx.GetStub().GetTxID(), len(j.entries)),
+		Type:          entryType,
+		PolicyID:      policyID,
+		DebitAccount:  debit.ID,
+		CreditAccount: credit.ID,
+		Amount:        amount,
+		Description:   description,
+		Timestamp:     j.now.Format(time.RFC3339Nano),
+	})
+
+	return nil
+}
+
+// account returns the in-memory copy of an account, loading it or opening it when missing
+func (j *journal) account(ref accountRef) (*Account, error) {
+	if account, ok := j.accounts[ref.ID]; ok {
+		return account, nil
+	}
+
+	account, err := readAccount(j.ctx, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		account = &Account{
+			ID:        ref.ID,
+			OwnerType: ref.OwnerType,
+			OwnerName: ref.OwnerName,
+			OwnerID:   ref.OwnerID,
+			CreatedAt: j.now.Format(time.RFC3339),
+		}
+	}
+
+	j.accounts[ref.ID] = account
+	j.order = append(j.order, ref.ID)
+	return account, nil
+}
+
+// commit issues payout instructions, then writes the touched accounts and indexes every entry under both of its accounts
+func (j *journal) commit() error {
+	if err := j.createPayoutInstructions(); err != nil {
+		return err
+	}
+
+	for _, id := range j.order {
+		if err := putAccount(j.ctx, j.accounts[id]); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range j.entries {
+		entryJSON, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		for _, accountID := range []string{entry.DebitAccount, entry.CreditAccount} {
+			key, err := j.ctx.GetStub().CreateCompositeKey(accountEntryObjectType, []string{accountID, entrySortKey(j.now), entry.ID})
+			if err != nil {
+				return err
+			}
+			if err := j.ctx.GetStub().PutState(key, entryJSON); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// postAndCommit records a single posting in its own journal
+func postAndCommit(ctx contractapi.TransactionContextInterface, entryType string, policyID int, from accountRef, to accountRef, amount float64, description string) error {
+	j, err := newJournal(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := j.post(entryType, policyID, from, to, amount, description); err != nil {
+		return err
+	}
+
+	return j.commit()
+}
+
+// OpenAccount opens a customer account with the given id, owned by the caller
+func (s *SmartContract) OpenAccount(ctx contractapi.TransactionContextInterface, accountID string, ownerName string) error {
+	if accountID == "" || ownerName == "" {
+		return fmt.Errorf("account id and owner name must not be empty")
+	}
+	if accountID == externalAccountID || accountID == payoutsInTransitRef().ID {
+		return fmt.Errorf("account id %s is reserved", accountID)
+	}
+	for _, prefix := range reservedAccountPrefixes {
+		if strings.HasPrefix(accountID, prefix) {
+			return fmt.Errorf("account ids starting with %s are reserved", prefix)
+		}
+	}
+
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	existing, err := readAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("account %s already exists", accountID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putAccount(ctx, &Account{
+		ID:        accountID,
+		OwnerType: CustomerAccount,
+		OwnerName: ownerName,
+		OwnerID:   owner,
+		CreatedAt: now.Format(time.RFC3339),
+	})
+}
+
+// GetAccount returns the account stored in the ledger with the given id
+func (s *SmartContract) GetAccount(ctx contractapi.TransactionContextInterface, accountID string) (*Account, error) {
+	account, err := readAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, fmt.Errorf("account %s does not exist", accountID)
+	}
+
+	return account, nil
+}
+
+// Withdraw pays money out of a customer account owned by the caller
+func (s *SmartContract) Withdraw(ctx contractapi.TransactionContextInterface, accountID string, amount float64) error {
+	account, err := s.GetAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account.OwnerType != CustomerAccount {
+		return fmt.Errorf("only customer accounts can be withdrawn from")
+	}
+	if err := requireAccountOwner(ctx, account); err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return fmt.Errorf("withdrawal amount must be greater than zero")
+	}
+
+	return postAndCommit(ctx, WithdrawalEntry, 0, accountRefOf(account), externalAccountRef(), amount, "Withdrawal")
+}
+
+// Transfer moves money from a customer account owned by the caller to another customer account
+func (s *SmartContract) Transfer(ctx contractapi.TransactionContextInterface, fromAccountID string, toAccountID string, amount float64) error {
+	if fromAccountID == toAccountID {
+		return fmt.Errorf("cannot transfer to the same account")
+	}
+	if amount <= 0 {
+		return fmt.Errorf("transfer amount must be greater than zero")
+	}
+
+	from, err := s.GetAccount(ctx, fromAccountID)
+	if err != nil {
+		return err
+	}
+	to, err := s.GetAccount(ctx, toAccountID)
+	if err != nil {
+		return err
+	}
+	if from.OwnerType != CustomerAccount || to.OwnerType != CustomerAccount {
+		return fmt.Errorf("transfers are only allowed between customer accounts")
+	}
+	if err := requireAccountOwner(ctx, from); err != nil {
+		return err
+	}
+
+	return postAndCommit(ctx, TransferEntry, 0, accountRefOf(from), accountRefOf(to), amount, "Transfer")
+}
+
+// requireAccountOwner checks that the caller owns the account, or is the insurer for accounts without an owner
+func requireAccountOwner(ctx contractapi.TransactionContextInterface, account *Account) error {
+	if account.OwnerID == "" {
+		return requireMSP(ctx, insurerMSPID, "pay out accounts without an owner")
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if caller != account.OwnerID {
+		return fmt.Errorf("account %s is not owned by the caller", account.ID)
+	}
+	return nil
+}
+
+func accountRefOf(account *Account) accountRef {
+	return accountRef{ID: account.ID, OwnerType: account.OwnerType, OwnerName: account.OwnerName, OwnerID: account.OwnerID}
+}
+
+// GetAccountStatement returns the entries of an account between from and to (RFC3339, either may be empty)
+// with the running balance after each entry
+func (s *SmartContract) GetAccountStatement(ctx contractapi.TransactionContextInterface, accountID string, from string, to string) (*AccountStatement, error) {
+	if _, err := s.GetAccount(ctx, accountID); err != nil {
+		return nil, err
+	}
+
+	var fromTime, toTime time.Time
+	var err error
+	if from != "" {
+		if fromTime, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, fmt.Errorf("failed to parse from date: %v", err)
+		}
+	}
+	if to != "" {
+		if toTime, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, fmt.Errorf("failed to parse to date: %v", err)
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountEntryObjectType, []string{accountID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	statement := AccountStatement{AccountID: accountID, From: from, To: to, Lines: []StatementLine{}}
+
+	// Entries are keyed by time, so the balance can be rebuilt from the first entry
+	var balance float64
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(queryResponse.Value, &entry); err != nil {
+			return nil, err
+		}
+
+		timestamp, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse entry timestamp: %v", err)
+		}
+
+		amount := entry.Amount
+		if entry.DebitAccount == accountID {
+			amount = -amount
+		}
+
+		if from != "" && timestamp.Before(fromTime) {
+			balance += amount
+			continue
+		}
+		if to != "" && timestamp.After(toTime) {
+			break
+		}
+
+		if len(statement.Lines) == 0 {
+			statement.OpeningBalance = balance
+		}
+		balance += amount
+		statement.Lines = append(statement.Lines, StatementLine{Entry: entry, Amount: amount, RunningBalance: balance})
+	}
+
+	if len(statement.Lines) == 0 {
+		statement.OpeningBalance = balance
+	}
+	statement.ClosingBalance = balance
+
+	return &statement, nil
+}
+
+// MigrateUserBalances moves the balances left in the former per-policy UserBalance field into the
+// customer accounts of up to batchSize policies starting at startID, and returns the next id to migrate.
+// Only administrators can run the migration.
+func (s *SmartContract) MigrateUserBalances(ctx contractapi.TransactionContextInterface, startID int, batchSize int) (int, error) {
+	if err := requireMSP(ctx, adminMSPID, "migrate policy balances"); err != nil {
+		return 0, err
+	}
+
+	if startID < 1 {
+		startID = 1
+	}
+	if batchSize <= 0 || batchSize > maxMaturityBatchSize {
+		return 0, fmt.Errorf("batch size must be between 1 and %d", maxMaturityBatchSize)
+	}
+
+	totalPolicies, err := s.GetTotalPoliciesCount(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	j, err := newJournal(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	id := startID
+	for ; id < startID+batchSize && id <= totalPolicies; id++ {
+		policyJSON, err := ctx.GetStub().GetState(strconv.Itoa(id))
+		if err != nil {
+			return 0, fmt.Errorf("failed to read policy %d: %v", id, err)
+		}
+		if policyJSON == nil {
+			continue
+		}
+
+		var legacy struct {
+			UserBalance float64 `json:"UserBalance"`
+		}
+		if err := json.Unmarshal(policyJSON, &legacy); err != nil {
+			return 0, err
+		}
+		if legacy.UserBalance <= 0 {
+			continue
+		}
+
+		var policy Policy
+		if err := json.Unmarshal(policyJSON, &policy); err != nil {
+			return 0, err
+		}
+
+		if err := j.post(TransferEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(&policy), legacy.UserBalance, "Migrated policy balance"); err != nil {
+			return 0, err
+		}
+
+		// Storing the policy again drops the legacy field
+		if err := putPolicy(ctx, &policy); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := j.commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func readAccount(ctx contractapi.TransactionContextInterface, accountID string) (*Account, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	accountJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read account %s: %v", accountID, err)
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+
+	var account Account
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func putAccount(ctx contractapi.TransactionContextInterface, account *Account) error {
+	key, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{account.ID})
+	if err != nil {
+		return err
+	}
+
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, accountJSON)
+}
+
+// entrySortKey formats a time so that keys sort chronologically
+func entrySortKey(t time.Time) string {
+	return t.UTC().Format("20060102T150405.000000000")
+}
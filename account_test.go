@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func TestMigrateUserBalancesNeedsAdministrator(t *testing.T) {
+	n := newTestNetwork(t)
+	n.healthPolicy()
+
+	n.mustFail("holder", "only members of Org1MSP can migrate policy balances", "MigrateUserBalances", "1", "10")
+	if next := n.mustInvoke("insurer", "MigrateUserBalances", "1", "10"); next == "1" {
+		t.Errorf("migration did not advance past policy 1, next id = %s", next)
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	agentObjectType      = "Agent"
+	commissionObjectType = "Commission"
+)
+
+// Intermediary types
+const (
+	TiedAgent = "Agent"
+	Broker    = "Broker"
+)
+
+// AgentAccount is the owner type of the accounts commissions are paid into
+const AgentAccount = "Agent"
+
+// Journal entry types of agent commissions
+const (
+	CommissionEntry         = "Commission"
+	CommissionClawbackEntry = "CommissionClawback"
+)
+
+// CommissionType tells whether a commission record pays or reverses a commission
+type CommissionType string
+
+const (
+	CommissionAccrual  CommissionType = "Accrual"
+	CommissionClawback CommissionType = "Clawback"
+)
+
+// CommissionSchedule holds the commission rates, as percentages of the premium, for policies of a package.
+// An empty PackageName applies to policies issued without a package.
+type CommissionSchedule struct {
+	PackageName   string  `json:"PackageName"`
+	FirstYearRate float64 `json:"FirstYearRate"`
+	RenewalRate   float64 `json:"RenewalRate"`
+}
+
+// Agent is a licensed agent or broker selling policies on commission
+type Agent struct {
+	ID            string               `json:"ID"`
+	Name          string               `json:"Name"`
+	Type          string               `json:"Type"`
+	LicenceNumber string               `json:"LicenceNumber"`
+	LicenceExpiry string               `json:"LicenceExpiry"`
+	Schedules     []CommissionSchedule `json:"Schedules,omitempty" metadata:",optional"`
+	CreatedAt     string               `json:"CreatedAt"`
+}
+
+// Commission records a commission accrued on a premium payment or clawed back from the agent
+type Commission struct {
+	ID         string         `json:"ID"`
+	AgentID    string         `json:"AgentID"`
+	PolicyID   int            `json:"PolicyID"`
+	Type       CommissionType `json:"Type"`
+	PolicyYear int            `json:"PolicyYear"`
+	FirstYear  bool           `json:"FirstYear"`
+	Premium    float64        `json:"Premium"`
+	Rate       float64        `json:"Rate"`
+	Amount     float64        `json:"Amount"`
+	Timestamp  string         `json:"Timestamp"`
+}
+
+// CommissionStatement lists the commissions of an agent within a period
+type CommissionStatement struct {
+	AgentID     string       `json:"AgentID"`
+	AgentName   string       `json:"AgentName"`
+	From        string       `json:"From"`
+	To          string       `json:"To"`
+	FirstYear   float64      `json:"FirstYear"`
+	Renewal     float64      `json:"Renewal"`
+	ClawedBack  float64      `json:"ClawedBack"`
+	Net         float64      `json:"Net"`
+	Commissions []Commission `json:"Commissions"`
+}
+
+// RegisterAgent registers an agent or broker with its licence, expiring at licenceExpiry (RFC3339), and commission schedules.
+// Only the insurer can register agents.
+func (s *SmartContract) RegisterAgent(ctx contractapi.TransactionContextInterface, id string, name string, agentType string, licenceNumber string, licenceExpiry string, schedules []CommissionSchedule) error {
+	if err := requireMSP(ctx, insurerMSPID, "register agents"); err != nil {
+		return err
+	}
+	if id == "" || name == "" {
+		return fmt.Errorf("agent id and name must not be empty")
+	}
+	if agentType != TiedAgent && agentType != Broker {
+		return fmt.Errorf("agent type must be %s or %s", TiedAgent, Broker)
+	}
+	if err := validateCommissionSchedules(schedules); err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := validateLicence(licenceNumber, licenceExpiry, now); err != nil {
+		return err
+	}
+
+	existing, err := readAgent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("agent %s already exists", id)
+	}
+
+	return putAgent(ctx, &Agent{
+		ID:            id,
+		Name:          name,
+		Type:          agentType,
+		LicenceNumber: licenceNumber,
+		LicenceExpiry: licenceExpiry,
+		Schedules:     schedules,
+		CreatedAt:     now.Format(time.RFC3339),
+	})
+}
+
+// ReadAgent returns the agent with the given id
+func (s *SmartContract) ReadAgent(ctx contractapi.TransactionContextInterface, id string) (*Agent, error) {
+	agent, err := readAgent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if agent == nil {
+		return nil, fmt.Errorf("agent %s does not exist", id)
+	}
+	return agent, nil
+}
+
+// RenewAgentLicence records a renewed licence of an agent. The renewal must expire after the current licence,
+// and a licence that has already expired can only be replaced by a newly issued licence number.
+// Only the insurer can renew licences.
+func (s *SmartContract) RenewAgentLicence(ctx contractapi.TransactionContextInterface, id string, licenceNumber string, licenceExpiry string) error {
+	if err := requireMSP(ctx, insurerMSPID, "renew agent licences"); err != nil {
+		return err
+	}
+
+	agent, err := s.ReadAgent(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	expiry, err := validateLicence(licenceNumber, licenceExpiry, now)
+	if err != nil {
+		return err
+	}
+
+	currentExpiry, err := time.Parse(time.RFC3339, agent.LicenceExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to parse licence expiry: %v", err)
+	}
+	if !expiry.After(currentExpiry) {
+		return fmt.Errorf("renewed licence must expire after the current licence, which expires on %s", agent.LicenceExpiry)
+	}
+	if !now.Before(currentExpiry) && licenceNumber == agent.LicenceNumber {
+		return fmt.Errorf("licence %s of agent %s expired on %s, a new licence number is required", agent.LicenceNumber, id, agent.LicenceExpiry)
+	}
+
+	agent.LicenceNumber = licenceNumber
+	agent.LicenceExpiry = licenceExpiry
+	return putAgent(ctx, agent)
+}
+
+// UpdateCommissionSchedules replaces the commission schedules of an agent; commissions already accrued are not changed.
+// Only the insurer can change commission schedules.
+func (s *SmartContract) UpdateCommissionSchedules(ctx contractapi.TransactionContextInterface, id string, schedules []CommissionSchedule) error {
+	if err := requireMSP(ctx, insurerMSPID, "change commission schedules"); err != nil {
+		return err
+	}
+
+	agent, err := s.ReadAgent(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := validateCommissionSchedules(schedules); err != nil {
+		return err
+	}
+
+	agent.Schedules = schedules
+	return putAgent(ctx, agent)
+}
+
+// SetSellingAgent records the agent who sold a policy. It can only be set before the first premium is paid,
+// and the agent must hold a valid licence. Only the policy holder and the insurer can set the agent.
+func (s *SmartContract) SetSellingAgent(ctx contractapi.TransactionContextInterface, id int, agentID string) error {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "set its selling agent"); err != nil {
+		return err
+	}
+
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot set the agent of a policy that is not active")
+	}
+	if policy.PaymentCount > 0 {
+		return fmt.Errorf("cannot change the agent of a policy after premiums have been paid")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkAgentLicensed(ctx, agentID, now); err != nil {
+		return err
+	}
+
+	policy.AgentID = agentID
+	return putPolicy(ctx, policy)
+}
+
+// GetAgentCommissionStatement returns the commissions of an agent between from and to (RFC3339, either may be empty)
+func (s *SmartContract) GetAgentCommissionStatement(ctx contractapi.TransactionContextInterface, agentID string, from string, to string) (*CommissionStatement, error) {
+	agent, err := s.ReadAgent(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var fromTime, toTime time.Time
+	if from != "" {
+		if fromTime, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, fmt.Errorf("failed to parse from date: %v", err)
+		}
+	}
+	if to != "" {
+		if toTime, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, fmt.Errorf("failed to parse to date: %v", err)
+		}
+	}
+
+	commissions, err := readCommissions(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	statement := CommissionStatement{AgentID: agentID, AgentName: agent.Name, From: from, To: to, Commissions: []Commission{}}
+	for _, commission := range commissions {
+		timestamp, err := time.Parse(time.RFC3339Nano, commission.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse commission timestamp: %v", err)
+		}
+		if from != "" && timestamp.Before(fromTime) {
+			continue
+		}
+		if to != "" && timestamp.After(toTime) {
+			break
+		}
+
+		switch {
+		case commission.Type == CommissionClawback:
+			statement.ClawedBack += commission.Amount
+		case commission.FirstYear:
+			statement.FirstYear += commission.Amount
+		default:
+			statement.Renewal += commission.Amount
+		}
+		statement.Commissions = append(statement.Commissions, commission)
+	}
+	statement.Net = statement.FirstYear + statement.Renewal - statement.ClawedBack
+
+	return &statement, nil
+}
+
+// accrueCommission posts the selling agent's commission on a premium payment to the journal and stores the
+// commission record. First-year rates apply during the first policy year and renewal rates afterwards.
+func (s *SmartContract) accrueCommission(ctx contractapi.TransactionContextInterface, j *journal, policy *Policy, premium float64) error {
+	if policy.AgentID == "" {
+		return nil
+	}
+
+	agent, err := s.ReadAgent(ctx, policy.AgentID)
+	if err != nil {
+		return err
+	}
+
+	year, err := policyYear(policy, j.now)
+	if err != nil {
+		return err
+	}
+
+	schedule, ok := commissionSchedule(agent, policy.PackageName)
+	if !ok {
+		return nil
+	}
+	// Renewed terms start a new policy year 1 but only earn renewal commission
+	firstYear := year == 1 && policy.RenewalOf == 0
+	rate := schedule.RenewalRate
+	if firstYear {
+		rate = schedule.FirstYearRate
+	}
+
+	amount := premium * rate / 100
+	if amount == 0 {
+		return nil
+	}
+
+	commission := Commission{
+		ID:         fmt.Sprintf("%s-C%03d", ctx.GetStub().GetTxID(), len(j.entries)),
+		AgentID:    agent.ID,
+		PolicyID:   policy.ID,
+		Type:       CommissionAccrual,
+		PolicyYear: year,
+		FirstYear:  firstYear,
+		Premium:    premium,
+		Rate:       rate,
+		Amount:     amount,
+		Timestamp:  j.now.Format(time.RFC3339Nano),
+	}
+
+	if err := j.post(CommissionEntry, policy.ID, insurerAccountRef(policy.CompanyName), agentAccountRef(agent), amount, "Commission on premium"); err != nil {
+		return err
+	}
+
+	return putCommission(ctx, &commission)
+}
+
+// clawbackCommissions reverses every commission still held by the selling agent on the policy
+func (s *SmartContract) clawbackCommissions(ctx contractapi.TransactionContextInterface, j *journal, policy *Policy) error {
+	if policy.AgentID == "" {
+		return nil
+	}
+
+	agent, err := s.ReadAgent(ctx, policy.AgentID)
+	if err != nil {
+		return err
+	}
+
+	commissions, err := readCommissions(ctx, agent.ID)
+	if err != nil {
+		return err
+	}
+
+	var held float64
+	for _, commission := range commissions {
+		if commission.PolicyID != policy.ID {
+			continue
+		}
+		if commission.Type == CommissionClawback {
+			held -= commission.Amount
+		} else {
+			held += commission.Amount
+		}
+	}
+	if held <= 0 {
+		return nil
+	}
+
+	commission := Commission{
+		ID:        fmt.Sprintf("%s-C%03d", ctx.GetStub().GetTxID(), len(j.entries)),
+		AgentID:   agent.ID,
+		PolicyID:  policy.ID,
+		Type:      CommissionClawback,
+		Amount:    held,
+		Timestamp: j.now.Format(time.RFC3339Nano),
+	}
+
+	// Agent accounts may go negative, leaving the agent owing the clawback
+	if err := j.post(CommissionClawbackEntry, policy.ID, agentAccountRef(agent), insurerAccountRef(policy.CompanyName), held, "Commission clawback"); err != nil {
+		return err
+	}
+
+	return putCommission(ctx, &commission)
+}
+
+// checkAgentLicensed checks that the agent exists and its licence is valid at the given time
+func (s *SmartContract) checkAgentLicensed(ctx contractapi.TransactionContextInterface, agentID string, now time.Time) error {
+	agent, err := s.ReadAgent(ctx, agentID)
+	if err != nil {
+		return err
+	}
+
+	expiry, err := time.Parse(time.RFC3339, agent.LicenceExpiry)
+	if err != nil {
+		return fmt.Errorf("failed to parse licence expiry: %v", err)
+	}
+	if !now.Before(expiry) {
+		return fmt.Errorf("licence %s of agent %s expired on %s", agent.LicenceNumber, agentID, agent.LicenceExpiry)
+	}
+
+	return nil
+}
+
+func agentAccountRef(agent *Agent) accountRef {
+	return accountRef{ID: "AGENT-" + agent.ID, OwnerType: AgentAccount, OwnerName: agent.Name}
+}
+
+// commissionSchedule returns the schedule for a package, falling back to the schedule without a package
+func commissionSchedule(agent *Agent, packageName string) (CommissionSchedule, bool) {
+	var fallback CommissionSchedule
+	found := false
+	for _, schedule := range agent.Schedules {
+		if schedule.PackageName == packageName {
+			return schedule, true
+		}
+		if schedule.PackageName == "" {
+			fallback, found = schedule, true
+		}
+	}
+	return fallback, found
+}
+
+// validateLicence checks the licence number and returns its expiry, which must be later than now
+func validateLicence(licenceNumber string, licenceExpiry string, now time.Time) (time.Time, error) {
+	if licenceNumber == "" {
+		return time.Time{}, fmt.Errorf("licence number must not be empty")
+	}
+	expiry, err := time.Parse(time.RFC3339, licenceExpiry)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse licence expiry: %v", err)
+	}
+	if !expiry.After(now) {
+		return time.Time{}, fmt.Errorf("licence expiry %s is not in the future", licenceExpiry)
+	}
+	return expiry, nil
+}
+
+func validateCommissionSchedules(schedules []CommissionSchedule) error {
+	seen := make(map[string]bool)
+	for _, schedule := range schedules {
+		if schedule.PackageName != "" {
+			if _, ok := packages[schedule.PackageName]; !ok {
+				return fmt.Errorf("package %s does not exist", schedule.PackageName)
+			}
+		}
+		if seen[schedule.PackageName] {
+			return fmt.Errorf("package %s has more than one commission schedule", schedule.PackageName)
+		}
+		seen[schedule.PackageName] = true
+
+		if schedule.FirstYearRate < 0 || schedule.FirstYearRate > 100 || schedule.RenewalRate < 0 || schedule.RenewalRate > 100 {
+			return fmt.Errorf("commission rates must be between 0 and 100")
+		}
+	}
+	return nil
+}
+
+// readAgent returns the agent with the given id, or nil when it does not exist
+func readAgent(ctx contractapi.TransactionContextInterface, id string) (*Agent, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(agentObjectType, []string{id})
+	if err != nil {
+		return nil, err
+	}
+
+	agentJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent %s: %v", id, err)
+	}
+	if agentJSON == nil {
+		return nil, nil
+	}
+
+	var agent Agent
+	err = json.Unmarshal(agentJSON, &agent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &agent, nil
+}
+
+func putAgent(ctx contractapi.TransactionContextInterface, agent *Agent) error {
+	key, err := ctx.GetStub().CreateCompositeKey(agentObjectType, []string{agent.ID})
+	if err != nil {
+		return err
+	}
+
+	agentJSON, err := json.Marshal(agent)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, agentJSON)
+}
+
+// readCommissions returns the commissions of an agent in time order
+func readCommissions(ctx contractapi.TransactionContextInterface, agentID string) ([]Commission, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(commissionObjectType, []string{agentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var commissions []Commission
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var commission Commission
+		if err := json.Unmarshal(queryResponse.Value, &commission); err != nil {
+			return nil, err
+		}
+		commissions = append(commissions, commission)
+	}
+
+	return commissions, nil
+}
+
+// putCommission indexes a commission by agent and time so statements can be read in order
+func putCommission(ctx contractapi.TransactionContextInterface, commission *Commission) error {
+	timestamp, err := time.Parse(time.RFC3339Nano, commission.Timestamp)
+	if err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(commissionObjectType, []string{commission.AgentID, entrySortKey(timestamp), commission.ID})
+	if err != nil {
+		return err
+	}
+
+	commissionJSON, err := json.Marshal(commission)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, commissionJSON)
+}
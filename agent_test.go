@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSetSellingAgent(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustInvoke("insurer", "RegisterAgent", "A1", "Alice", TiedAgent, "L-1", "2027-01-01T00:00:00Z", `[{"PackageName":"Silver","FirstYearRate":10,"RenewalRate":5}]`)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+
+	// Agents cannot attach themselves to other holders' policies to earn their commission
+	n.mustFail("stranger", "only the holder of policy", "SetSellingAgent", policyID, "A1")
+
+	n.mustInvoke("holder", "SetSellingAgent", policyID, "A1")
+	if policy := n.policy(id); policy.AgentID != "A1" {
+		t.Errorf("selling agent = %q, want A1", policy.AgentID)
+	}
+
+	n.payPremium(id, "1000")
+	n.mustFail("holder", "after premiums have been paid", "SetSellingAgent", policyID, "A1")
+	n.mustFail("insurer", "after premiums have been paid", "SetSellingAgent", policyID, "A1")
+}
@@ -114,9 +114,6 @@ async function main() {
         // Claim the policy.
         //await Cancel(contract);
 
-        // Claim the policy.
-        // await ClaimCoverage(contract);
-
         //await ReadPolicy(contract);
 
     } finally {
@@ -245,22 +242,6 @@ async function ReadPolicy(contract) {
 /**
  * submitTransaction() will throw an error containing details of any error responses from the smart contract.
  */
-async function ClaimCoverage(contract) {
-    console.log(
-        '\n--> Submit Transaction: ClaimCoverage '
-    );
-
-    try {
-        await contract.submitTransaction(
-            'ClaimCoverage',
-            '1',
-        );
-        console.log('******** FAILED to return an error');
-    } catch (error) {
-        console.log('*** Successfully caught the error: \n', error);
-    }
-}
-
 async function Cancel(contract) {
     console.log(
         '\n--> Submit Transaction: Cancel '
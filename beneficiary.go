@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	nomineeChangeObjectType = "NomineeChange"
+	deathClaimObjectType    = "DeathClaim"
+)
+
+// Beneficiary is a nominee entitled to a percentage share of a life policy's death benefit.
+// Contingent beneficiaries are only paid when no primary beneficiary survives.
+type Beneficiary struct {
+	Name         string  `json:"Name"`
+	Relationship string  `json:"Relationship"`
+	Share        float64 `json:"Share"`
+	AccountID    string  `json:"AccountID"`
+	Contingent   bool    `json:"Contingent"`
+}
+
+// NomineeChange records one change of the beneficiaries of a policy
+type NomineeChange struct {
+	ID        string        `json:"ID"`
+	PolicyID  int           `json:"PolicyID"`
+	Previous  []Beneficiary `json:"Previous,omitempty" metadata:",optional"`
+	Current   []Beneficiary `json:"Current"`
+	Reason    string        `json:"Reason"`
+	ChangedAt string        `json:"ChangedAt"`
+}
+
+// BeneficiaryPayout is the part of a death benefit paid to one beneficiary
+type BeneficiaryPayout struct {
+	Name      string  `json:"Name"`
+	AccountID string  `json:"AccountID"`
+	Share     float64 `json:"Share"`
+	Amount    float64 `json:"Amount"`
+}
+
+// DeathClaimSettlement records how the death benefit of a policy was split
+type DeathClaimSettlement struct {
+	PolicyID int     `json:"PolicyID"`
+	Amount   float64 `json:"Amount"`
+	// RiderBenefit is the part of Amount paid by an accidental death rider
+	RiderBenefit float64             `json:"RiderBenefit"`
+	Payouts      []BeneficiaryPayout `json:"Payouts"`
+	PaidToEstate float64             `json:"PaidToEstate"`
+	SettledAt    string              `json:"SettledAt"`
+}
+
+// SetBeneficiaries replaces the beneficiaries of an active life policy and keeps the previous ones in the nominee history.
+// Only the policy holder and the insurer can change beneficiaries.
+func (s *SmartContract) SetBeneficiaries(ctx contractapi.TransactionContextInterface, id int, beneficiaries []Beneficiary, reason string) error {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "change its beneficiaries"); err != nil {
+		return err
+	}
+
+	if policy.PolicyType != LifePolicy {
+		return fmt.Errorf("beneficiaries can only be set on life policies")
+	}
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot change beneficiaries of a policy that is not active")
+	}
+
+	if err := validateBeneficiaries(beneficiaries); err != nil {
+		return err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	change := NomineeChange{
+		ID:        ctx.GetStub().GetTxID(),
+		PolicyID:  id,
+		Previous:  policy.Beneficiaries,
+		Current:   beneficiaries,
+		Reason:    reason,
+		ChangedAt: now.Format(time.RFC3339),
+	}
+
+	changeKey, err := ctx.GetStub().CreateCompositeKey(nomineeChangeObjectType, []string{strconv.Itoa(id), change.ID})
+	if err != nil {
+		return err
+	}
+
+	changeJSON, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(changeKey, changeJSON); err != nil {
+		return err
+	}
+
+	policy.Beneficiaries = beneficiaries
+
+	return putPolicy(ctx, policy)
+}
+
+// GetNomineeHistory returns every change of beneficiaries made on the policy with the given id
+func (s *SmartContract) GetNomineeHistory(ctx contractapi.TransactionContextInterface, id int) ([]NomineeChange, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(nomineeChangeObjectType, []string{strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	changes := []NomineeChange{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var change NomineeChange
+		err = json.Unmarshal(queryResponse.Value, &change)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// ReadDeathClaim returns the death claim settlement of the policy with the given id
+func (s *SmartContract) ReadDeathClaim(ctx contractapi.TransactionContextInterface, id int) (*DeathClaimSettlement, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(deathClaimObjectType, []string{strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	settlementJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read death claim of policy %d: %v", id, err)
+	}
+	if settlementJSON == nil {
+		return nil, fmt.Errorf("policy %d has no death claim", id)
+	}
+
+	var settlement DeathClaimSettlement
+	err = json.Unmarshal(settlementJSON, &settlement)
+	if err != nil {
+		return nil, err
+	}
+
+	return &settlement, nil
+}
+
+// beneficiaryAccountRef returns the account a beneficiary is paid into, opening one for the beneficiary
+// of this policy when none was given
+func beneficiaryAccountRef(policyID int, payout BeneficiaryPayout) accountRef {
+	id := payout.AccountID
+	if id == "" {
+		id = fmt.Sprintf("CUSTOMER-POLICY-%d-%s", policyID, payout.Name)
+	}
+	return accountRef{ID: id, OwnerType: CustomerAccount, OwnerName: payout.Name}
+}
+
+// validateBeneficiaries checks that primary shares, and contingent shares when present, each sum to 100
+func validateBeneficiaries(beneficiaries []Beneficiary) error {
+	var primaryShares, contingentShares float64
+	var primaries, contingents int
+
+	for _, beneficiary := range beneficiaries {
+		if beneficiary.Name == "" {
+			return fmt.Errorf("beneficiary name must not be empty")
+		}
+		if beneficiary.Share <= 0 || beneficiary.Share > 100 {
+			return fmt.Errorf("share of beneficiary %s must be greater than 0 and at most 100", beneficiary.Name)
+		}
+
+		if beneficiary.Contingent {
+			contingentShares += beneficiary.Share
+			contingents++
+		} else {
+			primaryShares += beneficiary.Share
+			primaries++
+		}
+	}
+
+	if primaries == 0 {
+		return fmt.Errorf("at least one primary beneficiary is required")
+	}
+	if math.Abs(primaryShares-100) > 1e-9 {
+		return fmt.Errorf("primary beneficiary shares must sum to 100, got %v", primaryShares)
+	}
+	if contingents > 0 && math.Abs(contingentShares-100) > 1e-9 {
+		return fmt.Errorf("contingent beneficiary shares must sum to 100, got %v", contingentShares)
+	}
+
+	return nil
+}
+
+// splitDeathBenefit divides the amount among the surviving primary beneficiaries in proportion to their shares,
+// falling back to the contingent beneficiaries when no primary survives and to the estate when nobody does
+func splitDeathBenefit(amount float64, beneficiaries []Beneficiary, predeceased []string) ([]BeneficiaryPayout, float64) {
+	deceased := make(map[string]bool, len(predeceased))
+	for _, name := range predeceased {
+		deceased[name] = true
+	}
+
+	var primaries, contingents []Beneficiary
+	for _, beneficiary := range beneficiaries {
+		if deceased[beneficiary.Name] {
+			continue
+		}
+		if beneficiary.Contingent {
+			contingents = append(contingents, beneficiary)
+		} else {
+			primaries = append(primaries, beneficiary)
+		}
+	}
+
+	entitled := primaries
+	if len(entitled) == 0 {
+		entitled = contingents
+	}
+	if len(entitled) == 0 {
+		return []BeneficiaryPayout{}, amount
+	}
+
+	var totalShares float64
+	for _, beneficiary := range entitled {
+		totalShares += beneficiary.Share
+	}
+
+	payouts := make([]BeneficiaryPayout, 0, len(entitled))
+	remaining := amount
+	for i, beneficiary := range entitled {
+		share := beneficiary.Share / totalShares * 100
+		payout := amount * share / 100
+		// The last beneficiary receives the remainder so the payouts add up exactly
+		if i == len(entitled)-1 {
+			payout = remaining
+		}
+		remaining -= payout
+
+		payouts = append(payouts, BeneficiaryPayout{
+			Name:      beneficiary.Name,
+			AccountID: beneficiary.AccountID,
+			Share:     share,
+			Amount:    payout,
+		})
+	}
+
+	return payouts, 0
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDeathBenefitSplit(t *testing.T) {
+	n := newTestNetwork(t)
+	id := strconv.Itoa(lifePolicy(n))
+
+	beneficiaries := `[{"Name":"Cem","Relationship":"Child","Share":60,"AccountID":"","Contingent":false},` +
+		`{"Name":"Dana","Relationship":"Spouse","Share":40,"AccountID":"","Contingent":false}]`
+	n.mustFail("stranger", "only the holder of policy", "SetBeneficiaries", id, beneficiaries, "redirect")
+	n.mustInvoke("holder", "SetBeneficiaries", id, beneficiaries, "nomination")
+
+	n.mustFail("holder", "can settle death claims", "ClaimDeathBenefit", id, "[]", "false")
+
+	var settlement DeathClaimSettlement
+	n.mustInvokeJSON(&settlement, "insurer", "ClaimDeathBenefit", id, `["Dana"]`, "false")
+
+	// Dana predeceased the insured, so Cem receives the whole benefit
+	if settlement.Amount != 10000 || len(settlement.Payouts) != 1 || settlement.Payouts[0].Name != "Cem" || settlement.Payouts[0].Amount != 10000 {
+		t.Errorf("settlement = %+v, want 10000 paid to Cem", settlement)
+	}
+
+	var history []NomineeChange
+	n.mustInvokeJSON(&history, "holder", "GetNomineeHistory", id)
+	if len(history) != 1 || history[0].Reason != "nomination" {
+		t.Errorf("nominee history = %+v, want the one nomination", history)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxBulkRows keeps a bulk transaction well within Fabric's transaction size limits
+const maxBulkRows = 500
+
+// BulkPolicyRow describes one policy to issue in BulkCreatePolicies. Health rows are priced from Premium,
+// InstallmentNo and ProfitPercentage, life rows from the mortality fields, unless a package is given.
+type BulkPolicyRow struct {
+	PolicyType       string      `json:"PolicyType"`
+	HolderName       string      `json:"HolderName"`
+	Age              int         `json:"Age"`
+	Gender           string      `json:"Gender"`
+	Location         string      `json:"Location"`
+	CompanyName      string      `json:"CompanyName"`
+	PackageName      string      `json:"PackageName"`
+	Premium          float64     `json:"Premium"`
+	InstallmentNo    int         `json:"InstallmentNo"`
+	ProfitPercentage float64     `json:"ProfitPercentage"`
+	LifeProduct      LifeProduct `json:"LifeProduct"`
+	MortalityTableID string      `json:"MortalityTableID"`
+	SumAssured       float64     `json:"SumAssured"`
+	TermYears        int         `json:"TermYears"`
+	InterestRate     float64     `json:"InterestRate"`
+	AgentID          string      `json:"AgentID"`
+	// HolderID is the client identity of the holder, the caller issuing the rows when empty
+	HolderID string `json:"HolderID"`
+}
+
+// BulkPaymentRow describes one premium payment to post in BulkPayPremiums
+type BulkPaymentRow struct {
+	PolicyID int     `json:"PolicyID"`
+	Amount   float64 `json:"Amount"`
+}
+
+// BulkRowResult is the outcome of one row; Error is empty when the row is valid
+type BulkRowResult struct {
+	Index    int    `json:"Index"`
+	PolicyID int    `json:"PolicyID"`
+	Error    string `json:"Error"`
+}
+
+// BulkResult reports the per-row outcome of a bulk transaction. Rows are only written when every row is
+// valid and the call is not a dry run, in which case Committed is true.
+type BulkResult struct {
+	DryRun    bool            `json:"DryRun"`
+	Total     int             `json:"Total"`
+	Valid     int             `json:"Valid"`
+	Committed bool            `json:"Committed"`
+	Rows      []BulkRowResult `json:"Rows"`
+}
+
+// BulkCreatePolicies validates and issues many policies at once. Either all rows are written or,
+// when any row is invalid or dryRun is set, nothing is written and the per-row errors are returned.
+// Only the insurer can issue policies in bulk, since the rows name their holders.
+func (s *SmartContract) BulkCreatePolicies(ctx contractapi.TransactionContextInterface, rows []BulkPolicyRow, dryRun bool) (*BulkResult, error) {
+	if err := requireMSP(ctx, insurerMSPID, "issue policies in bulk"); err != nil {
+		return nil, err
+	}
+
+	if err := checkBulkSize(len(rows)); err != nil {
+		return nil, err
+	}
+
+	result := BulkResult{DryRun: dryRun, Total: len(rows), Rows: make([]BulkRowResult, len(rows))}
+	terms := make([]PricedTerms, len(rows))
+	for i, row := range rows {
+		result.Rows[i].Index = i
+
+		rowTerms, err := s.validatePolicyRow(ctx, row)
+		if err != nil {
+			result.Rows[i].Error = err.Error()
+			continue
+		}
+		terms[i] = rowTerms
+		result.Valid++
+	}
+
+	if dryRun || result.Valid != result.Total {
+		return &result, nil
+	}
+
+	firstID, err := s.reserveIDs(ctx, len(rows))
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveDate, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	for i, row := range rows {
+		holderID := row.HolderID
+		if holderID == "" {
+			holderID = caller
+		}
+
+		if err := fillTermMonths(ctx, row.PolicyType, &terms[i]); err != nil {
+			return nil, err
+		}
+
+		policy := newPolicy(firstID+i, effectiveDate, Policy{
+			HolderName:  row.HolderName,
+			HolderID:    holderID,
+			Age:         row.Age,
+			Gender:      row.Gender,
+			Location:    row.Location,
+			CompanyName: row.CompanyName,
+			PolicyType:  row.PolicyType,
+			AgentID:     row.AgentID,
+		}, terms[i])
+
+		if err := putPolicy(ctx, &policy); err != nil {
+			return nil, err
+		}
+		result.Rows[i].PolicyID = policy.ID
+	}
+	result.Committed = true
+
+	return &result, nil
+}
+
+// BulkPayPremiums validates and posts many premium payments at once, at most one per policy since
+// installments must be paid at least 10 seconds apart. As in PayPremium the caller pays with tokens:
+// the total is transferred to the insurer's token account before anything is recorded. Either all rows
+// are written or, when any row is invalid, the transfer fails or dryRun is set, nothing is written.
+//
+// The token chaincode only reads committed balances, so a second transfer from the caller in the same
+// transaction would overwrite the first debit; all rows must therefore pay premiums to the same company.
+func (s *SmartContract) BulkPayPremiums(ctx contractapi.TransactionContextInterface, rows []BulkPaymentRow, dryRun bool) (*BulkResult, error) {
+	if err := checkBulkSize(len(rows)); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := BulkResult{DryRun: dryRun, Total: len(rows), Rows: make([]BulkRowResult, len(rows))}
+
+	firstRow := make(map[int]int)
+	policies := make(map[int]*Policy)
+	var companyName string
+	var total float64
+	for i, row := range rows {
+		result.Rows[i].Index = i
+		result.Rows[i].PolicyID = row.PolicyID
+
+		if first, duplicate := firstRow[row.PolicyID]; duplicate {
+			result.Rows[i].Error = fmt.Sprintf("policy %d is already paid in row %d, only one payment per policy can be posted at once", row.PolicyID, first)
+			continue
+		}
+		firstRow[row.PolicyID] = i
+
+		policy, err := s.ReadPolicy(ctx, row.PolicyID)
+		if err != nil {
+			result.Rows[i].Error = err.Error()
+			continue
+		}
+		policies[row.PolicyID] = policy
+
+		if companyName == "" {
+			companyName = policy.CompanyName
+		}
+		if policy.CompanyName != companyName {
+			result.Rows[i].Error = fmt.Sprintf("policy %d is insured by %s, but all rows must pay premiums to %s", row.PolicyID, policy.CompanyName, companyName)
+			continue
+		}
+
+		if err := applyPremiumPayment(policy, row.Amount, now); err != nil {
+			result.Rows[i].Error = err.Error()
+			continue
+		}
+		total += row.Amount
+		result.Valid++
+	}
+
+	if dryRun || result.Valid != result.Total {
+		return &result, nil
+	}
+
+	// Move the tokens before recording anything, so a failed transfer leaves no payment behind
+	transferID, err := transferPremiumTokens(ctx, companyName, total)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := newJournal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		policy := policies[row.PolicyID]
+		if err := j.post(PremiumEntry, row.PolicyID, externalAccountRef(), insurerAccountRef(policy.CompanyName), row.Amount, "Premium payment, token transfer "+transferID); err != nil {
+			return nil, err
+		}
+		if err := s.accrueCommission(ctx, j, policy, row.Amount); err != nil {
+			return nil, err
+		}
+	}
+	if err := j.commit(); err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		if err := putPolicy(ctx, policies[row.PolicyID]); err != nil {
+			return nil, err
+		}
+	}
+	result.Committed = true
+
+	return &result, nil
+}
+
+// validatePolicyRow checks a bulk policy row and prices it without writing to the ledger
+func (s *SmartContract) validatePolicyRow(ctx contractapi.TransactionContextInterface, row BulkPolicyRow) (PricedTerms, error) {
+	if row.PolicyType != HealthPolicy && row.PolicyType != LifePolicy {
+		return PricedTerms{}, fmt.Errorf("policy type must be %s or %s", HealthPolicy, LifePolicy)
+	}
+	if row.HolderName == "" {
+		return PricedTerms{}, fmt.Errorf("holder name must not be empty")
+	}
+	if row.Age <= 0 {
+		return PricedTerms{}, fmt.Errorf("age must be greater than zero")
+	}
+	if row.PolicyType == HealthPolicy && row.PackageName == "" && (row.Premium <= 0 || row.InstallmentNo <= 0) {
+		return PricedTerms{}, fmt.Errorf("premium and installment number must be greater than zero without a package")
+	}
+
+	if row.AgentID != "" {
+		now, err := txTime(ctx)
+		if err != nil {
+			return PricedTerms{}, err
+		}
+		if err := s.checkAgentLicensed(ctx, row.AgentID, now); err != nil {
+			return PricedTerms{}, err
+		}
+	}
+
+	if row.PolicyType == LifePolicy {
+		return s.priceLifeTerms(ctx, row.PackageName, row.Gender, row.Age, string(row.LifeProduct), row.MortalityTableID, row.SumAssured, row.TermYears, row.InterestRate)
+	}
+	return s.priceTerms(ctx, row.PackageName, row.Premium, row.InstallmentNo, row.ProfitPercentage)
+}
+
+func checkBulkSize(n int) error {
+	if n == 0 {
+		return fmt.Errorf("at least one row is required")
+	}
+	if n > maxBulkRows {
+		return fmt.Errorf("at most %d rows can be processed in one transaction, got %d", maxBulkRows, n)
+	}
+	return nil
+}
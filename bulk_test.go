@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBulkCreatePolicies(t *testing.T) {
+	n := newTestNetwork(t)
+	holderID := n.mustInvokeToken("holder", "ClientAccountID")
+	rows := fmt.Sprintf(`[{"PolicyType":%q,"HolderName":"Ann","Age":30,"Gender":"","Location":"Berlin","CompanyName":"Acme","PackageName":"Silver","Premium":0,"InstallmentNo":0,"ProfitPercentage":0,"LifeProduct":"","MortalityTableID":"","SumAssured":0,"TermYears":0,"InterestRate":0,"AgentID":"","HolderID":%q}]`, HealthPolicy, holderID)
+
+	// Customers cannot issue policies to other holders through the bulk import
+	n.mustFail("holder", "only members of Org1MSP can issue policies in bulk", "BulkCreatePolicies", rows, "false")
+
+	var result BulkResult
+	n.mustInvokeJSON(&result, "insurer", "BulkCreatePolicies", rows, "false")
+	if !result.Committed || result.Valid != 1 {
+		t.Fatalf("bulk result = %+v, want one committed row", result)
+	}
+	if policy := n.policy(result.Rows[0].PolicyID); policy.HolderID != holderID {
+		t.Errorf("policy holder = %s, want %s", policy.HolderID, holderID)
+	}
+}
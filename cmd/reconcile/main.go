@@ -0,0 +1,73 @@
+// Command reconcile matches the deposits on a bank statement with the premium payments recorded on the ledger.
+// It runs entirely offline on exported files:
+//
+//	reconcile -statement statement.csv -payments payments.json -out reports
+//
+// The statement is a CSV file or an ISO 20022 camt.053 XML file. The payments file is the JSON output of
+// GetAccountStatement or a JSON array of journal entries; only Premium entries are reconciled.
+// A deposit matches a payment when its reference names the journal entry id or the policy as in "POL-12".
+// Matched, unmatched and duplicate lines are written as CSV reports to the output directory.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	statementPath := flag.String("statement", "", "bank statement file (.csv or camt.053 .xml)")
+	paymentsPath := flag.String("payments", "", "JSON export of ledger payments")
+	outDir := flag.String("out", ".", "directory the reports are written to")
+	dateTolerance := flag.Int("days", 3, "maximum number of days between the bank booking date and the payment")
+	amountTolerance := flag.Float64("amount-tolerance", 0.01, "maximum difference between the bank amount and the payment amount")
+	flag.Parse()
+
+	if *statementPath == "" || *paymentsPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*statementPath, *paymentsPath, *outDir, *dateTolerance, *amountTolerance); err != nil {
+		fmt.Fprintf(os.Stderr, "reconcile: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(statementPath string, paymentsPath string, outDir string, dateTolerance int, amountTolerance float64) error {
+	var lines []BankLine
+	var err error
+	switch strings.ToLower(filepath.Ext(statementPath)) {
+	case ".csv":
+		lines, err = readCSVStatement(statementPath)
+	case ".xml":
+		lines, err = readCamtStatement(statementPath)
+	default:
+		return fmt.Errorf("statement must be a .csv or camt.053 .xml file, got %s", statementPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	payments, err := readPayments(paymentsPath)
+	if err != nil {
+		return err
+	}
+
+	result := reconcile(lines, payments, dateTolerance, amountTolerance)
+
+	if err := writeReports(outDir, result); err != nil {
+		return err
+	}
+
+	fmt.Printf("bank lines:          %d\n", len(lines))
+	fmt.Printf("payments:            %d\n", len(payments))
+	fmt.Printf("matched:             %d\n", len(result.Matched))
+	fmt.Printf("duplicates:          %d\n", len(result.Duplicates))
+	fmt.Printf("unmatched bank:      %d\n", len(result.UnmatchedBank))
+	fmt.Printf("unmatched payments:  %d\n", len(result.UnmatchedPayments))
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// premiumEntryType is the journal entry type of PayPremium and BulkPayPremiums
+const premiumEntryType = "Premium"
+
+// Payment is a premium journal entry exported from the ledger, with the same JSON fields as JournalEntry
+type Payment struct {
+	ID            string    `json:"ID"`
+	Type          string    `json:"Type"`
+	PolicyID      int       `json:"PolicyID"`
+	DebitAccount  string    `json:"DebitAccount"`
+	CreditAccount string    `json:"CreditAccount"`
+	Amount        float64   `json:"Amount"`
+	Description   string    `json:"Description"`
+	Timestamp     string    `json:"Timestamp"`
+	Time          time.Time `json:"-"`
+}
+
+// statementExport is the JSON returned by GetAccountStatement
+type statementExport struct {
+	Lines []struct {
+		Entry Payment `json:"Entry"`
+	} `json:"Lines"`
+}
+
+// readPayments reads the premium payments of a GetAccountStatement export or a JSON array of journal entries
+func readPayments(path string) ([]Payment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Payment
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var statement statementExport
+		if err := json.Unmarshal(trimmed, &statement); err != nil {
+			return nil, fmt.Errorf("failed to parse account statement: %v", err)
+		}
+		for _, line := range statement.Lines {
+			entries = append(entries, line.Entry)
+		}
+	} else if err := json.Unmarshal(trimmed, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse payments: %v", err)
+	}
+
+	// An entry appears in the statements of both its accounts, so exports may repeat it
+	seen := make(map[string]bool)
+	var payments []Payment
+	for _, entry := range entries {
+		if entry.Type != premiumEntryType || seen[entry.ID] {
+			continue
+		}
+		seen[entry.ID] = true
+
+		entry.Time, err = time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("payment %s: failed to parse timestamp: %v", entry.ID, err)
+		}
+		payments = append(payments, entry)
+	}
+
+	return payments, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Match pairs a bank line with the ledger payment it settles
+type Match struct {
+	Bank      BankLine
+	Payment   Payment
+	DaysApart int
+}
+
+// Duplicate is a bank line whose payment was already matched, or that repeats an earlier bank reference
+type Duplicate struct {
+	Bank     BankLine
+	Original string
+	Reason   string
+}
+
+// Result holds the outcome of a reconciliation
+type Result struct {
+	Matched           []Match
+	Duplicates        []Duplicate
+	UnmatchedBank     []BankLine
+	UnmatchedPayments []Payment
+}
+
+// reconcile matches every bank line to the closest unmatched payment with the same reference and amount
+// booked within dateTolerance days. Lines are processed by booking date so the earliest deposit wins.
+func reconcile(lines []BankLine, payments []Payment, dateTolerance int, amountTolerance float64) Result {
+	sorted := make([]BankLine, len(lines))
+	copy(sorted, lines)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	var result Result
+	matchedBy := make(map[string]string)
+	bankRefs := make(map[string]bool)
+
+	for _, line := range sorted {
+		if bankRefs[line.BankRef] {
+			result.Duplicates = append(result.Duplicates, Duplicate{Bank: line, Original: line.BankRef, Reason: "repeated bank reference"})
+			continue
+		}
+		bankRefs[line.BankRef] = true
+
+		best := -1
+		bestDays := 0
+		var alreadyMatched string
+		for i, payment := range payments {
+			if math.Abs(payment.Amount-line.Amount) > amountTolerance || !referenceMatches(line.Reference, payment) {
+				continue
+			}
+
+			days := daysApart(line, payment)
+			if days > dateTolerance {
+				continue
+			}
+
+			if bankRef, ok := matchedBy[payment.ID]; ok {
+				alreadyMatched = bankRef
+				continue
+			}
+			if best == -1 || days < bestDays {
+				best, bestDays = i, days
+			}
+		}
+
+		switch {
+		case best != -1:
+			matchedBy[payments[best].ID] = line.BankRef
+			result.Matched = append(result.Matched, Match{Bank: line, Payment: payments[best], DaysApart: bestDays})
+		case alreadyMatched != "":
+			result.Duplicates = append(result.Duplicates, Duplicate{Bank: line, Original: alreadyMatched, Reason: "payment already matched"})
+		default:
+			result.UnmatchedBank = append(result.UnmatchedBank, line)
+		}
+	}
+
+	for _, payment := range payments {
+		if _, ok := matchedBy[payment.ID]; !ok {
+			result.UnmatchedPayments = append(result.UnmatchedPayments, payment)
+		}
+	}
+
+	return result
+}
+
+// policyReference finds a policy reference such as "POL-12", "Policy 12" or "policy #0012" in a bank reference.
+// A bare number is not enough, since amounts, dates and invoice numbers appear in references too.
+var policyReference = regexp.MustCompile(`(?i)\bpol(?:icy)?[ \t\-_#:.]*0*([0-9]+)\b`)
+
+// referenceMatches reports whether a bank reference names the payment's journal entry or its policy id
+func referenceMatches(reference string, payment Payment) bool {
+	if payment.ID != "" {
+		tokens := strings.FieldsFunc(reference, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-'
+		})
+		for _, token := range tokens {
+			if strings.EqualFold(token, payment.ID) {
+				return true
+			}
+		}
+	}
+
+	policyID := strconv.Itoa(payment.PolicyID)
+	for _, match := range policyReference.FindAllStringSubmatch(reference, -1) {
+		if match[1] == policyID {
+			return true
+		}
+	}
+	return false
+}
+
+// daysApart returns the number of calendar days between the bank booking date and the payment
+func daysApart(line BankLine, payment Payment) int {
+	bankDay := line.Date.UTC().Truncate(24 * time.Hour)
+	paymentDay := payment.Time.UTC().Truncate(24 * time.Hour)
+
+	days := int(bankDay.Sub(paymentDay).Hours() / 24)
+	if days < 0 {
+		days = -days
+	}
+	return days
+}
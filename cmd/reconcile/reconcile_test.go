@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeStatement(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func payment(id string, policyID int, amount float64, day int) Payment {
+	return Payment{ID: id, Type: premiumEntryType, PolicyID: policyID, Amount: amount, Time: time.Date(2026, 3, day, 12, 0, 0, 0, time.UTC)}
+}
+
+func bankLine(bankRef string, reference string, amount float64, day int) BankLine {
+	return BankLine{BankRef: bankRef, Reference: reference, Amount: amount, Date: time.Date(2026, 3, day, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestReferenceMatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		want      bool
+	}{
+		{"policy with dash", "Premium POL-12 March", true},
+		{"policy word", "policy 12", true},
+		{"policy with hash and zeros", "Policy #0012", true},
+		{"entry id", "tx7f3a-000 premium", true},
+		{"entry id in other case", "TX7F3A-000", true},
+		{"bare number", "Premium 12", false},
+		{"number in date", "Payment 2026-03-12", false},
+		{"other policy", "POL-123", false},
+		{"policy prefix inside word", "APOL-12", false},
+		{"entry id prefix", "tx7f3a-0001", false},
+	}
+
+	p := payment("tx7f3a-000", 12, 100, 1)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := referenceMatches(test.reference, p); got != test.want {
+				t.Errorf("referenceMatches(%q) = %v, want %v", test.reference, got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadCSVStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []BankLine
+	}{
+		{
+			name:    "bank reference column",
+			content: "Booking Date,Amount,Currency,Reference,Transaction ID\n2026-03-02,100.00,EUR,POL-1,B1\n2026-03-03,-50,EUR,fee,B2\n",
+			want:    []BankLine{{Line: 2, BankRef: "B1", Amount: 100, Currency: "EUR", Reference: "POL-1"}},
+		},
+		{
+			name:    "positional reference",
+			content: "date,credit,description\n02.03.2026,\"1,250.50\",Policy 7\n",
+			want:    []BankLine{{Line: 2, BankRef: "L2", Amount: 1250.50, Reference: "Policy 7"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines, err := readCSVStatement(writeStatement(t, "statement.csv", test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLines(t, lines, test.want)
+		})
+	}
+}
+
+func TestReadCamtStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries string
+		want    []BankLine
+	}{
+		{
+			name: "single transaction",
+			entries: `<Ntry><Amt Ccy="EUR">100.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts><Cd>BOOK</Cd></Sts>
+				<BookgDt><Dt>2026-03-02</Dt></BookgDt><AcctSvcrRef>S1</AcctSvcrRef>
+				<NtryDtls><TxDtls><RmtInf><Ustrd>POL-1</Ustrd></RmtInf></TxDtls></NtryDtls></Ntry>`,
+			want: []BankLine{{Line: 1, BankRef: "S1", Amount: 100, Currency: "EUR", Reference: "POL-1"}},
+		},
+		{
+			name: "batch without servicer reference",
+			entries: `<Ntry><Amt Ccy="EUR">0</Amt><CdtDbtInd>DBIT</CdtDbtInd><BookgDt><Dt>2026-03-01</Dt></BookgDt></Ntry>
+				<Ntry><Amt Ccy="EUR">300.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2026-03-02</Dt></BookgDt>
+				<NtryDtls>
+					<TxDtls><Amt Ccy="EUR">100.00</Amt><RmtInf><Ustrd>POL-1</Ustrd></RmtInf></TxDtls>
+					<TxDtls><Amt Ccy="EUR">200.00</Amt><RmtInf><Strd><CdtrRefInf><Ref>POL-2</Ref></CdtrRefInf></Strd></RmtInf></TxDtls>
+				</NtryDtls></Ntry>`,
+			want: []BankLine{
+				{Line: 2, BankRef: "L2/1", Amount: 100, Currency: "EUR", Reference: "POL-1"},
+				{Line: 2, BankRef: "L2/2", Amount: 200, Currency: "EUR", Reference: "POL-2"},
+			},
+		},
+		{
+			name: "entry without details or servicer reference",
+			entries: `<Ntry><Amt Ccy="EUR">75.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><ValDt><Dt>2026-03-02</Dt></ValDt></Ntry>
+				<Ntry><Amt Ccy="EUR">80.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>PDNG</Sts><BookgDt><Dt>2026-03-02</Dt></BookgDt></Ntry>`,
+			want: []BankLine{{Line: 1, BankRef: "L1", Amount: 75, Currency: "EUR"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08"><BkToCstmrStmt><Stmt>` + test.entries + `</Stmt></BkToCstmrStmt></Document>`
+			lines, err := readCamtStatement(writeStatement(t, "statement.xml", content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLines(t, lines, test.want)
+		})
+	}
+}
+
+func checkLines(t *testing.T, lines []BankLine, want []BankLine) {
+	t.Helper()
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(lines), len(want), lines)
+	}
+	for i, line := range lines {
+		if line.Line != want[i].Line || line.BankRef != want[i].BankRef || line.Amount != want[i].Amount ||
+			line.Currency != want[i].Currency || line.Reference != want[i].Reference {
+			t.Errorf("line %d = %+v, want %+v", i, line, want[i])
+		}
+		if line.Date.Format("2006-01-02") != "2026-03-02" {
+			t.Errorf("line %d date = %s, want 2026-03-02", i, line.Date)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name              string
+		lines             []BankLine
+		payments          []Payment
+		matched           []string
+		duplicates        []string
+		unmatchedBank     []string
+		unmatchedPayments []string
+	}{
+		{
+			name:     "match within date tolerance",
+			lines:    []BankLine{bankLine("B1", "POL-1", 100, 4)},
+			payments: []Payment{payment("E1", 1, 100, 1)},
+			matched:  []string{"B1:E1"},
+		},
+		{
+			name:              "outside date tolerance",
+			lines:             []BankLine{bankLine("B1", "POL-1", 100, 5)},
+			payments:          []Payment{payment("E1", 1, 100, 1)},
+			unmatchedBank:     []string{"B1"},
+			unmatchedPayments: []string{"E1"},
+		},
+		{
+			name:     "within amount tolerance",
+			lines:    []BankLine{bankLine("B1", "POL-1", 100.005, 1)},
+			payments: []Payment{payment("E1", 1, 100, 1)},
+			matched:  []string{"B1:E1"},
+		},
+		{
+			name:              "outside amount tolerance",
+			lines:             []BankLine{bankLine("B1", "POL-1", 100.02, 1)},
+			payments:          []Payment{payment("E1", 1, 100, 1)},
+			unmatchedBank:     []string{"B1"},
+			unmatchedPayments: []string{"E1"},
+		},
+		{
+			name:              "undelimited number does not match",
+			lines:             []BankLine{bankLine("B1", "Invoice 1", 100, 1)},
+			payments:          []Payment{payment("E1", 1, 100, 1)},
+			unmatchedBank:     []string{"B1"},
+			unmatchedPayments: []string{"E1"},
+		},
+		{
+			name:              "closest payment wins",
+			lines:             []BankLine{bankLine("B1", "POL-1", 100, 3)},
+			payments:          []Payment{payment("E1", 1, 100, 1), payment("E2", 1, 100, 3)},
+			matched:           []string{"B1:E2"},
+			unmatchedPayments: []string{"E1"},
+		},
+		{
+			name:              "repeated bank reference",
+			lines:             []BankLine{bankLine("B1", "POL-1", 100, 1), bankLine("B1", "POL-1", 100, 2)},
+			payments:          []Payment{payment("E1", 1, 100, 1), payment("E2", 1, 100, 2)},
+			matched:           []string{"B1:E1"},
+			duplicates:        []string{"B1"},
+			unmatchedPayments: []string{"E2"},
+		},
+		{
+			name:       "payment already matched",
+			lines:      []BankLine{bankLine("B1", "POL-1", 100, 1), bankLine("B2", "E1", 100, 2)},
+			payments:   []Payment{payment("E1", 1, 100, 1)},
+			matched:    []string{"B1:E1"},
+			duplicates: []string{"B2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := reconcile(test.lines, test.payments, 3, 0.01)
+
+			var matched, duplicates, unmatchedBank, unmatchedPayments []string
+			for _, match := range result.Matched {
+				matched = append(matched, match.Bank.BankRef+":"+match.Payment.ID)
+			}
+			for _, duplicate := range result.Duplicates {
+				duplicates = append(duplicates, duplicate.Bank.BankRef)
+			}
+			for _, line := range result.UnmatchedBank {
+				unmatchedBank = append(unmatchedBank, line.BankRef)
+			}
+			for _, payment := range result.UnmatchedPayments {
+				unmatchedPayments = append(unmatchedPayments, payment.ID)
+			}
+
+			checkRefs(t, "matched", matched, test.matched)
+			checkRefs(t, "duplicates", duplicates, test.duplicates)
+			checkRefs(t, "unmatched bank", unmatchedBank, test.unmatchedBank)
+			checkRefs(t, "unmatched payments", unmatchedPayments, test.unmatchedPayments)
+		})
+	}
+}
+
+func checkRefs(t *testing.T, kind string, got []string, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s = %v, want %v", kind, got, want)
+		return
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("%s = %v, want %v", kind, got, want)
+			return
+		}
+	}
+}
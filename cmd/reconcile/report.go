@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const reportDateLayout = "2006-01-02"
+
+// writeReports writes matched.csv, duplicates.csv, unmatched_bank.csv and unmatched_payments.csv to dir
+func writeReports(dir string, result Result) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	matched := [][]string{{"BankRef", "BookingDate", "Amount", "Currency", "Reference", "PaymentID", "PolicyID", "PaymentTime", "DaysApart"}}
+	for _, match := range result.Matched {
+		matched = append(matched, []string{
+			match.Bank.BankRef,
+			match.Bank.Date.Format(reportDateLayout),
+			formatAmount(match.Bank.Amount),
+			match.Bank.Currency,
+			match.Bank.Reference,
+			match.Payment.ID,
+			strconv.Itoa(match.Payment.PolicyID),
+			match.Payment.Timestamp,
+			strconv.Itoa(match.DaysApart),
+		})
+	}
+
+	duplicates := [][]string{{"BankRef", "BookingDate", "Amount", "Currency", "Reference", "Original", "Reason"}}
+	for _, duplicate := range result.Duplicates {
+		duplicates = append(duplicates, []string{
+			duplicate.Bank.BankRef,
+			duplicate.Bank.Date.Format(reportDateLayout),
+			formatAmount(duplicate.Bank.Amount),
+			duplicate.Bank.Currency,
+			duplicate.Bank.Reference,
+			duplicate.Original,
+			duplicate.Reason,
+		})
+	}
+
+	unmatchedBank := [][]string{{"BankRef", "BookingDate", "Amount", "Currency", "Reference"}}
+	for _, line := range result.UnmatchedBank {
+		unmatchedBank = append(unmatchedBank, []string{
+			line.BankRef,
+			line.Date.Format(reportDateLayout),
+			formatAmount(line.Amount),
+			line.Currency,
+			line.Reference,
+		})
+	}
+
+	unmatchedPayments := [][]string{{"PaymentID", "PolicyID", "Amount", "PaymentTime", "CreditAccount"}}
+	for _, payment := range result.UnmatchedPayments {
+		unmatchedPayments = append(unmatchedPayments, []string{
+			payment.ID,
+			strconv.Itoa(payment.PolicyID),
+			formatAmount(payment.Amount),
+			payment.Timestamp,
+			payment.CreditAccount,
+		})
+	}
+
+	reports := []struct {
+		name    string
+		records [][]string
+	}{
+		{"matched.csv", matched},
+		{"duplicates.csv", duplicates},
+		{"unmatched_bank.csv", unmatchedBank},
+		{"unmatched_payments.csv", unmatchedPayments},
+	}
+	for _, report := range reports {
+		if err := writeCSV(filepath.Join(dir, report.name), report.records); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeCSV(path string, records [][]string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(records); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BankLine is one credit on the bank statement
+type BankLine struct {
+	Line      int
+	BankRef   string
+	Date      time.Time
+	Amount    float64
+	Currency  string
+	Reference string
+}
+
+// dateLayouts are the booking date formats accepted in CSV statements
+var dateLayouts = []string{"2006-01-02", time.RFC3339, "02.01.2006", "02/01/2006"}
+
+// csvColumns maps the accepted CSV header names to the field they fill
+var csvColumns = map[string]string{
+	"date":           "date",
+	"booking date":   "date",
+	"value date":     "date",
+	"amount":         "amount",
+	"credit":         "amount",
+	"currency":       "currency",
+	"reference":      "reference",
+	"description":    "reference",
+	"remittance":     "reference",
+	"id":             "bankref",
+	"transaction id": "bankref",
+	"bank reference": "bankref",
+}
+
+// readCSVStatement reads a CSV statement with a header row; debits (negative amounts) are skipped
+func readCSVStatement(path string) ([]BankLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read statement header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		if field, ok := csvColumns[strings.ToLower(strings.TrimSpace(name))]; ok {
+			if _, seen := columns[field]; !seen {
+				columns[field] = i
+			}
+		}
+	}
+	for _, field := range []string{"date", "amount", "reference"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("statement has no %s column", field)
+		}
+	}
+
+	var lines []BankLine
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read statement line %d: %v", row, err)
+		}
+
+		value := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		amountText := value("amount")
+		if amountText == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(amountText, ",", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse amount %q: %v", row, amountText, err)
+		}
+		if amount <= 0 {
+			continue
+		}
+
+		date, err := parseDate(value("date"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", row, err)
+		}
+
+		bankRef := value("bankref")
+		if bankRef == "" {
+			bankRef = "L" + strconv.Itoa(row)
+		}
+
+		lines = append(lines, BankLine{
+			Line:      row,
+			BankRef:   bankRef,
+			Date:      date,
+			Amount:    amount,
+			Currency:  value("currency"),
+			Reference: value("reference"),
+		})
+	}
+
+	return lines, nil
+}
+
+// camtDocument is the part of a camt.053 bank-to-customer statement the reconciliation needs
+type camtDocument struct {
+	Statements []struct {
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+	Amount       camtAmount `xml:"Amt"`
+	CreditDebit  string     `xml:"CdtDbtInd"`
+	Status       camtStatus `xml:"Sts"`
+	BookingDate  camtDate   `xml:"BookgDt"`
+	ValueDate    camtDate   `xml:"ValDt"`
+	ServicerRef  string     `xml:"AcctSvcrRef"`
+	Transactions []struct {
+		Amount       camtAmount `xml:"Amt"`
+		AmountInstd  camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+		EndToEndID   string     `xml:"Refs>EndToEndId"`
+		ServicerRef  string     `xml:"Refs>AcctSvcrRef"`
+		Unstructured []string   `xml:"RmtInf>Ustrd"`
+		Structured   []string   `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+// camtStatus is a plain code up to camt.053.001.07 and a Cd element from version 08
+type camtStatus struct {
+	Value string `xml:",chardata"`
+	Code  string `xml:"Cd"`
+}
+
+func (s camtStatus) code() string {
+	if s.Code != "" {
+		return s.Code
+	}
+	return strings.TrimSpace(s.Value)
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+// readCamtStatement reads the credit entries of a camt.053 statement, one line per transaction of batched entries
+func readCamtStatement(path string) ([]BankLine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var document camtDocument
+	if err := xml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse camt.053 statement: %v", err)
+	}
+
+	var lines []BankLine
+	line := 0
+	for _, statement := range document.Statements {
+		for _, entry := range statement.Entries {
+			line++
+			if entry.CreditDebit != "CRDT" {
+				continue
+			}
+			// Pending entries are not booked yet
+			if entry.Status.code() == "PDNG" {
+				continue
+			}
+
+			// AcctSvcrRef is optional; fall back to the entry's position like CSV lines without an id
+			entryRef := entry.ServicerRef
+			if entryRef == "" {
+				entryRef = "L" + strconv.Itoa(line)
+			}
+
+			date, err := entry.BookingDate.parse()
+			if err != nil {
+				date, err = entry.ValueDate.parse()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: %v", line, err)
+			}
+
+			if len(entry.Transactions) == 0 {
+				amount, err := strconv.ParseFloat(strings.TrimSpace(entry.Amount.Value), 64)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: failed to parse amount: %v", line, err)
+				}
+				lines = append(lines, BankLine{
+					Line:     line,
+					BankRef:  entryRef,
+					Date:     date,
+					Amount:   amount,
+					Currency: entry.Amount.Currency,
+				})
+				continue
+			}
+
+			for i, tx := range entry.Transactions {
+				// A single transaction may omit its amount, in which case it is the entry amount
+				amount := tx.Amount
+				if amount.Value == "" {
+					amount = tx.AmountInstd
+				}
+				if amount.Value == "" {
+					amount = entry.Amount
+				}
+
+				value, err := strconv.ParseFloat(strings.TrimSpace(amount.Value), 64)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d: failed to parse amount: %v", line, err)
+				}
+
+				bankRef := tx.ServicerRef
+				if bankRef == "" {
+					bankRef = entryRef
+					if len(entry.Transactions) > 1 {
+						bankRef += "/" + strconv.Itoa(i+1)
+					}
+				}
+
+				var references []string
+				references = append(references, tx.Structured...)
+				references = append(references, tx.Unstructured...)
+				if tx.EndToEndID != "" && tx.EndToEndID != "NOTPROVIDED" {
+					references = append(references, tx.EndToEndID)
+				}
+
+				lines = append(lines, BankLine{
+					Line:      line,
+					BankRef:   bankRef,
+					Date:      date,
+					Amount:    value,
+					Currency:  amount.Currency,
+					Reference: strings.Join(references, " "),
+				})
+			}
+		}
+	}
+
+	return lines, nil
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if d.Date != "" {
+		return time.Parse("2006-01-02", d.Date)
+	}
+	if d.DateTime != "" {
+		return time.Parse(time.RFC3339, d.DateTime)
+	}
+	return time.Time{}, fmt.Errorf("entry has no date")
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to parse date %q", value)
+}
@@ -0,0 +1,21 @@
+// Command token runs the token chaincode premiums are paid with; deploy it on the insurance channel as "token"
+package main
+
+import (
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/token"
+)
+
+func main() {
+	chaincode, err := contractapi.NewChaincode(&token.TokenContract{})
+	if err != nil {
+		log.Panicf("Error creating token chaincode: %v", err)
+	}
+
+	if err := chaincode.Start(); err != nil {
+		log.Panicf("Error starting token chaincode: %v", err)
+	}
+}
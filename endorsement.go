@@ -0,0 +1,581 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const endorsementObjectType = "Endorsement"
+
+// Declare the default MSP of the underwriters approving endorsements and the setting overriding it
+const (
+	defaultUnderwriterMSPID = "Org1MSP"
+	underwriterMSPIDSetting = "underwriterMSPID"
+)
+
+// Endorsement types
+const (
+	SumInsuredChange  = "SumInsuredChange"
+	AddressChange     = "AddressChange"
+	InstallmentChange = "InstallmentChange"
+	AccountChange     = "AccountChange"
+)
+
+// EndorsementStatus represents where an endorsement is in underwriting
+type EndorsementStatus string
+
+const (
+	EndorsementPending  EndorsementStatus = "Pending"
+	EndorsementApproved EndorsementStatus = "Approved"
+	EndorsementRejected EndorsementStatus = "Rejected"
+)
+
+// Endorsement is a mid-term change of a policy. It is priced when requested, priced again against the
+// policy as it stands when an underwriter approves it, and only then applied to the policy.
+// Only the fields of its Type are set; the Previous fields hold the values it replaces.
+type Endorsement struct {
+	PolicyID              int               `json:"PolicyID"`
+	Number                int               `json:"Number"`
+	Type                  string            `json:"Type"`
+	Status                EndorsementStatus `json:"Status"`
+	EffectiveDate         string            `json:"EffectiveDate"`
+	PreviousSumInsured    float64           `json:"PreviousSumInsured"`
+	SumInsured            float64           `json:"SumInsured"`
+	PreviousLocation      string            `json:"PreviousLocation"`
+	Location              string            `json:"Location"`
+	PreviousInstallmentNo int               `json:"PreviousInstallmentNo"`
+	InstallmentNo         int               `json:"InstallmentNo"`
+	PreviousAccountID     string            `json:"PreviousAccountID"`
+	AccountID             string            `json:"AccountID"`
+	// An installment change derives the term again from the new number of installments, see policyTermMonths
+	PreviousTermMonths int    `json:"PreviousTermMonths"`
+	TermMonths         int    `json:"TermMonths"`
+	ExpirationDate     string `json:"ExpirationDate"`
+	// RemainingFraction is the part of the term left at the EffectiveDate, over which premium is adjusted
+	RemainingFraction float64 `json:"RemainingFraction"`
+	AdditionalPremium float64 `json:"AdditionalPremium"`
+	RefundPremium     float64 `json:"RefundPremium"`
+	// InstallmentPremium is the premium of each installment still to be paid after the endorsement
+	InstallmentPremium float64 `json:"InstallmentPremium"`
+	TotalPremiumToPay  float64 `json:"TotalPremiumToPay"`
+	RequestedBy        string  `json:"RequestedBy"`
+	RequestedAt        string  `json:"RequestedAt"`
+	DecidedBy          string  `json:"DecidedBy"`
+	DecidedAt          string  `json:"DecidedAt"`
+	RejectionReason    string  `json:"RejectionReason"`
+}
+
+// RequestSumInsuredChange requests a new sum insured from the effective date, an empty date meaning now.
+// An increase is charged pro rata over the remaining installments; a decrease first lowers the unpaid premium
+// and refunds the rest. Returns the endorsement number.
+func (s *SmartContract) RequestSumInsuredChange(ctx contractapi.TransactionContextInterface, id int, sumInsured float64, effectiveDate string) (int, error) {
+	if sumInsured <= 0 {
+		return 0, fmt.Errorf("sum insured must be greater than zero")
+	}
+	return s.requestEndorsement(ctx, id, effectiveDate, Endorsement{Type: SumInsuredChange, SumInsured: sumInsured})
+}
+
+// RequestAddressChange requests a change of the insured's address from the effective date, an empty date meaning now.
+// Returns the endorsement number.
+func (s *SmartContract) RequestAddressChange(ctx contractapi.TransactionContextInterface, id int, location string, effectiveDate string) (int, error) {
+	if location == "" {
+		return 0, fmt.Errorf("location must not be empty")
+	}
+	return s.requestEndorsement(ctx, id, effectiveDate, Endorsement{Type: AddressChange, Location: location})
+}
+
+// RequestInstallmentChange requests a new number of installments, the unpaid premium being spread over those
+// still to be paid. Installments already paid cannot be removed. The term, expiration and maturity dates follow
+// the new number of installments where the term depends on it. Returns the endorsement number.
+func (s *SmartContract) RequestInstallmentChange(ctx contractapi.TransactionContextInterface, id int, installmentNo int, effectiveDate string) (int, error) {
+	if installmentNo <= 0 {
+		return 0, fmt.Errorf("installment number must be greater than zero")
+	}
+	return s.requestEndorsement(ctx, id, effectiveDate, Endorsement{Type: InstallmentChange, InstallmentNo: installmentNo})
+}
+
+// RequestAccountChange requests that the payouts of a policy go to another customer account from the effective date,
+// an empty date meaning now. Only the policy holder can request it, and only for an account they own.
+// Returns the endorsement number.
+func (s *SmartContract) RequestAccountChange(ctx contractapi.TransactionContextInterface, id int, accountID string, effectiveDate string) (int, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if policy.HolderID == "" || caller != policy.HolderID {
+		return 0, fmt.Errorf("only the holder of policy %d can change its account", id)
+	}
+
+	account, err := s.GetAccount(ctx, accountID)
+	if err != nil {
+		return 0, err
+	}
+	if account.OwnerType != CustomerAccount {
+		return 0, fmt.Errorf("account %s is not a customer account", accountID)
+	}
+	if account.OwnerID != caller {
+		return 0, fmt.Errorf("account %s is not owned by the policy holder", accountID)
+	}
+
+	return s.requestEndorsement(ctx, id, effectiveDate, Endorsement{Type: AccountChange, AccountID: accountID})
+}
+
+// ApproveEndorsement reprices a pending endorsement against the current policy and applies it.
+// Only underwriters may approve, and never an endorsement they requested themselves.
+func (s *SmartContract) ApproveEndorsement(ctx contractapi.TransactionContextInterface, id int, number int) (*Endorsement, error) {
+	policy, endorsement, err := s.pendingEndorsement(ctx, id, number)
+	if err != nil {
+		return nil, err
+	}
+
+	underwriter, err := requireUnderwriter(ctx, endorsement)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := priceEndorsement(ctx, policy, endorsement); err != nil {
+		return nil, err
+	}
+
+	if endorsement.RefundPremium > 0 {
+		if err := postAndCommit(ctx, RefundEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(policy), endorsement.RefundPremium, fmt.Sprintf("Endorsement %d refund", number)); err != nil {
+			return nil, err
+		}
+	}
+
+	applyEndorsement(policy, endorsement)
+
+	endorsement.Status = EndorsementApproved
+	endorsement.DecidedBy = underwriter
+	endorsement.DecidedAt = now.Format(time.RFC3339)
+
+	if err := putEndorsement(ctx, endorsement); err != nil {
+		return nil, err
+	}
+	if err := putPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return endorsement, nil
+}
+
+// RejectEndorsement closes a pending endorsement without changing the policy
+func (s *SmartContract) RejectEndorsement(ctx contractapi.TransactionContextInterface, id int, number int, reason string) error {
+	_, endorsement, err := s.pendingEndorsement(ctx, id, number)
+	if err != nil {
+		return err
+	}
+
+	underwriter, err := requireUnderwriter(ctx, endorsement)
+	if err != nil {
+		return err
+	}
+
+	if reason == "" {
+		return fmt.Errorf("rejection reason must not be empty")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	endorsement.Status = EndorsementRejected
+	endorsement.DecidedBy = underwriter
+	endorsement.DecidedAt = now.Format(time.RFC3339)
+	endorsement.RejectionReason = reason
+
+	return putEndorsement(ctx, endorsement)
+}
+
+// ReadEndorsement returns the endorsement with the given number of a policy
+func (s *SmartContract) ReadEndorsement(ctx contractapi.TransactionContextInterface, id int, number int) (*Endorsement, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(endorsementObjectType, []string{strconv.Itoa(id), paddedKey(number)})
+	if err != nil {
+		return nil, err
+	}
+
+	endorsementJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read endorsement %d of policy %d: %v", number, id, err)
+	}
+	if endorsementJSON == nil {
+		return nil, fmt.Errorf("endorsement %d of policy %d does not exist", number, id)
+	}
+
+	var endorsement Endorsement
+	err = json.Unmarshal(endorsementJSON, &endorsement)
+	if err != nil {
+		return nil, err
+	}
+
+	return &endorsement, nil
+}
+
+// GetPolicyEndorsements returns the endorsements of the policy with the given id in number order
+func (s *SmartContract) GetPolicyEndorsements(ctx contractapi.TransactionContextInterface, id int) ([]Endorsement, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(endorsementObjectType, []string{strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	endorsements := []Endorsement{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var endorsement Endorsement
+		err = json.Unmarshal(queryResponse.Value, &endorsement)
+		if err != nil {
+			return nil, err
+		}
+		endorsements = append(endorsements, endorsement)
+	}
+
+	return endorsements, nil
+}
+
+// GetUnderwriterMSPID returns the MSP whose members approve endorsements
+func (s *SmartContract) GetUnderwriterMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return underwriterMSPID(ctx)
+}
+
+// UpdateUnderwriterMSPID updates the MSP whose members approve endorsements; only administrators can change it
+func (s *SmartContract) UpdateUnderwriterMSPID(ctx contractapi.TransactionContextInterface, mspID string) error {
+	if mspID == "" {
+		return fmt.Errorf("MSP id must not be empty")
+	}
+	return putSetting(ctx, underwriterMSPIDSetting, mspID)
+}
+
+func underwriterMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID := defaultUnderwriterMSPID
+	if err := readSetting(ctx, underwriterMSPIDSetting, &mspID); err != nil {
+		return "", err
+	}
+	return mspID, nil
+}
+
+// requestEndorsement numbers, prices and stores a pending endorsement. A policy has at most one pending
+// endorsement, so each one is priced against the policy left by the previous one.
+// Only the policy holder and the insurer can request endorsements.
+func (s *SmartContract) requestEndorsement(ctx contractapi.TransactionContextInterface, id int, effectiveDate string, endorsement Endorsement) (int, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "request endorsements on it"); err != nil {
+		return 0, err
+	}
+
+	if policy.PolicyStatus != Active {
+		return 0, fmt.Errorf("cannot endorse a policy that is %s", policy.PolicyStatus)
+	}
+
+	endorsements, err := s.GetPolicyEndorsements(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	for _, existing := range endorsements {
+		if existing.Status == EndorsementPending {
+			return 0, fmt.Errorf("endorsement %d of policy %d is still pending", existing.Number, id)
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	effective, err := endorsementEffectiveDate(policy, effectiveDate, now)
+	if err != nil {
+		return 0, err
+	}
+
+	requester, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	policy.EndorsementCount++
+
+	endorsement.PolicyID = id
+	endorsement.Number = policy.EndorsementCount
+	endorsement.Status = EndorsementPending
+	endorsement.EffectiveDate = effective.Format(time.RFC3339)
+	endorsement.RequestedBy = requester
+	endorsement.RequestedAt = now.Format(time.RFC3339)
+
+	if err := priceEndorsement(ctx, policy, &endorsement); err != nil {
+		return 0, err
+	}
+
+	if err := putEndorsement(ctx, &endorsement); err != nil {
+		return 0, err
+	}
+	if err := putPolicy(ctx, policy); err != nil {
+		return 0, err
+	}
+
+	return endorsement.Number, nil
+}
+
+// pendingEndorsement reads an endorsement awaiting a decision together with its active policy
+func (s *SmartContract) pendingEndorsement(ctx contractapi.TransactionContextInterface, id int, number int) (*Policy, *Endorsement, error) {
+	endorsement, err := s.ReadEndorsement(ctx, id, number)
+	if err != nil {
+		return nil, nil, err
+	}
+	if endorsement.Status != EndorsementPending {
+		return nil, nil, fmt.Errorf("endorsement %d of policy %d is already %s", number, id, endorsement.Status)
+	}
+
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy.PolicyStatus != Active {
+		return nil, nil, fmt.Errorf("cannot endorse a policy that is %s", policy.PolicyStatus)
+	}
+
+	return policy, endorsement, nil
+}
+
+// requireUnderwriter checks that the caller is an underwriter other than the requester and returns the caller's id
+func requireUnderwriter(ctx contractapi.TransactionContextInterface, endorsement *Endorsement) (string, error) {
+	underwriters, err := underwriterMSPID(ctx)
+	if err != nil {
+		return "", err
+	}
+	if err := requireMSP(ctx, underwriters, "decide on endorsements"); err != nil {
+		return "", err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if clientID == endorsement.RequestedBy {
+		return "", fmt.Errorf("an endorsement must be decided by someone other than its requester")
+	}
+
+	return clientID, nil
+}
+
+// endorsementEffectiveDate parses the requested effective date, which must fall within the policy term
+// and must not be earlier than now: endorsements cannot be backdated
+func endorsementEffectiveDate(policy *Policy, effectiveDate string, now time.Time) (time.Time, error) {
+	if effectiveDate == "" {
+		return now, nil
+	}
+
+	effective, err := time.Parse(time.RFC3339, effectiveDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse effective date: %v", err)
+	}
+
+	start, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse policy effective date: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse policy expiration date: %v", err)
+	}
+
+	if effective.Before(start) || !effective.Before(end) {
+		return time.Time{}, fmt.Errorf("effective date must fall between %s and %s", policy.EffectiveDate, policy.ExpirationDate)
+	}
+	if effective.Before(now) {
+		return time.Time{}, fmt.Errorf("effective date must not be earlier than %s", now.Format(time.RFC3339))
+	}
+
+	return effective, nil
+}
+
+// priceEndorsement checks the endorsement against the policy and calculates its premium adjustment
+func priceEndorsement(ctx contractapi.TransactionContextInterface, policy *Policy, endorsement *Endorsement) error {
+	effective, err := time.Parse(time.RFC3339, endorsement.EffectiveDate)
+	if err != nil {
+		return fmt.Errorf("failed to parse effective date: %v", err)
+	}
+
+	elapsed, err := elapsedTermFraction(policy, effective)
+	if err != nil {
+		return err
+	}
+
+	endorsement.RemainingFraction = 1 - elapsed
+	endorsement.AdditionalPremium = 0
+	endorsement.RefundPremium = 0
+	endorsement.InstallmentPremium = policy.Premium
+	endorsement.TotalPremiumToPay = policy.TotalPremiumToPay
+
+	remainingInstallments := policy.InstallmentNo - policy.PaymentCount
+	// Rider premiums are due on top of the installment premium, so only the base premium is spread over installments
+	unpaid := math.Max(policy.TotalPremiumToPay-policy.TotalPaid-remainingRiderPremiums(policy), 0)
+
+	switch endorsement.Type {
+	case SumInsuredChange:
+		endorsement.PreviousSumInsured = endorsedSumInsured(policy)
+		if endorsement.PreviousSumInsured <= 0 {
+			return fmt.Errorf("policy %d has no sum insured to change", policy.ID)
+		}
+		if endorsement.SumInsured == endorsement.PreviousSumInsured {
+			return fmt.Errorf("sum insured is already %v", endorsement.SumInsured)
+		}
+
+		// The premium of the remaining term scales with the sum insured
+		change := policy.TotalPremiumToPay * (endorsement.SumInsured/endorsement.PreviousSumInsured - 1) * endorsement.RemainingFraction
+		if change > 0 {
+			if policy.PremiumsWaived || remainingInstallments <= 0 {
+				return fmt.Errorf("no installments are left to collect the additional premium")
+			}
+			endorsement.AdditionalPremium = change
+		} else {
+			endorsement.RefundPremium = math.Max(-change-unpaid, 0)
+		}
+
+		endorsement.TotalPremiumToPay = policy.TotalPremiumToPay + change
+		unpaid = math.Max(endorsement.TotalPremiumToPay-(policy.TotalPaid-endorsement.RefundPremium)-remainingRiderPremiums(policy), 0)
+		if remainingInstallments > 0 {
+			endorsement.InstallmentPremium = unpaid / float64(remainingInstallments)
+		}
+
+	case AddressChange:
+		endorsement.PreviousLocation = policy.Location
+		if endorsement.Location == policy.Location {
+			return fmt.Errorf("location is already %s", endorsement.Location)
+		}
+
+	case AccountChange:
+		endorsement.PreviousAccountID = customerAccountRef(policy).ID
+		if endorsement.AccountID == endorsement.PreviousAccountID {
+			return fmt.Errorf("payouts already go to account %s", endorsement.AccountID)
+		}
+
+	case InstallmentChange:
+		endorsement.PreviousInstallmentNo = policy.InstallmentNo
+		if endorsement.InstallmentNo == policy.InstallmentNo {
+			return fmt.Errorf("policy already has %d installments", endorsement.InstallmentNo)
+		}
+		if policy.PremiumsWaived {
+			return fmt.Errorf("premiums on this policy have been waived")
+		}
+		if endorsement.InstallmentNo <= policy.PaymentCount {
+			return fmt.Errorf("%d installments are already paid, at least one more must remain", policy.PaymentCount)
+		}
+
+		endorsement.InstallmentPremium = unpaid / float64(endorsement.InstallmentNo-policy.PaymentCount)
+
+		months, err := policyTermMonths(ctx, policy.PolicyType, policy.PackageName, endorsement.InstallmentNo)
+		if err != nil {
+			return err
+		}
+		start, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+		if err != nil {
+			return fmt.Errorf("failed to parse policy effective date: %v", err)
+		}
+		expirationDate := start.AddDate(0, months, 0)
+		if !expirationDate.After(effective) {
+			return fmt.Errorf("a term of %d months would end before the endorsement takes effect", months)
+		}
+
+		endorsement.PreviousTermMonths = policy.TermMonths
+		endorsement.TermMonths = months
+		endorsement.ExpirationDate = expirationDate.Format(time.RFC3339)
+
+	default:
+		return fmt.Errorf("unknown endorsement type %s", endorsement.Type)
+	}
+
+	return nil
+}
+
+// applyEndorsement changes the policy as priced by priceEndorsement. A refund is taken off the premium paid,
+// and once nothing is left to pay no further installments are due.
+func applyEndorsement(policy *Policy, endorsement *Endorsement) {
+	switch endorsement.Type {
+	case SumInsuredChange:
+		if policy.PolicyType == HealthPolicy {
+			// Coverage keeps its ratio to the sum insured, which includes any no-claims bonus
+			policy.Coverage *= endorsement.SumInsured / endorsement.PreviousSumInsured
+			policy.HealthTerms.SumInsured = endorsement.SumInsured
+		} else {
+			policy.Coverage = endorsement.SumInsured
+		}
+		policy.TotalPremiumToPay = endorsement.TotalPremiumToPay
+		policy.TotalPaid -= endorsement.RefundPremium
+		if policy.TotalPaid >= policy.TotalPremiumToPay {
+			policy.InstallmentNo = policy.PaymentCount
+		} else {
+			policy.Premium = endorsement.InstallmentPremium
+			rebaseFloaterPremium(policy)
+		}
+
+	case AddressChange:
+		policy.Location = endorsement.Location
+
+	case AccountChange:
+		policy.AccountID = endorsement.AccountID
+
+	case InstallmentChange:
+		policy.InstallmentNo = endorsement.InstallmentNo
+		policy.Premium = endorsement.InstallmentPremium
+		rebaseFloaterPremium(policy)
+		policy.TermMonths = endorsement.TermMonths
+		policy.ExpirationDate = endorsement.ExpirationDate
+		if policy.PolicyType == LifePolicy {
+			policy.MaturityDate = policy.ExpirationDate
+		}
+		// Riders end with the policy's installments at the latest
+		for i := range policy.Riders {
+			rider := &policy.Riders[i]
+			if rider.Status == RiderActive && rider.EndInstallment > policy.InstallmentNo {
+				policy.TotalPremiumToPay -= rider.Premium * float64(rider.EndInstallment-policy.InstallmentNo)
+				rider.EndInstallment = policy.InstallmentNo
+			}
+		}
+	}
+}
+
+// endorsedSumInsured is the health sum insured of health policies and the coverage of life policies
+func endorsedSumInsured(policy *Policy) float64 {
+	if policy.PolicyType == HealthPolicy {
+		return policy.HealthTerms.SumInsured
+	}
+	return policy.Coverage
+}
+
+func putEndorsement(ctx contractapi.TransactionContextInterface, endorsement *Endorsement) error {
+	key, err := ctx.GetStub().CreateCompositeKey(endorsementObjectType, []string{strconv.Itoa(endorsement.PolicyID), paddedKey(endorsement.Number)})
+	if err != nil {
+		return err
+	}
+
+	endorsementJSON, err := json.Marshal(endorsement)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, endorsementJSON)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestApproveAddressChange(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+
+	n.mustFail("stranger", "only the holder of policy", "RequestAddressChange", policyID, "Hamburg", "")
+	number := n.mustInvoke("holder", "RequestAddressChange", policyID, "Hamburg", "")
+
+	n.mustFail("holder", "only members of Org1MSP can decide on endorsements", "ApproveEndorsement", policyID, number)
+
+	var endorsement Endorsement
+	n.mustInvokeJSON(&endorsement, "underwriter", "ApproveEndorsement", policyID, number)
+	if endorsement.Status != EndorsementApproved || endorsement.PreviousLocation != "Berlin" {
+		t.Errorf("endorsement is %s replacing %q, want approved replacing Berlin", endorsement.Status, endorsement.PreviousLocation)
+	}
+	if policy := n.policy(id); policy.Location != "Hamburg" {
+		t.Errorf("location = %s, want Hamburg", policy.Location)
+	}
+
+	// Underwriters cannot approve their own requests
+	number = n.mustInvoke("underwriter", "RequestAddressChange", policyID, "Munich", "")
+	n.mustFail("underwriter", "someone other than its requester", "ApproveEndorsement", policyID, number)
+	n.mustInvoke("insurer", "RejectEndorsement", policyID, number, "no proof of address")
+	if policy := n.policy(id); policy.Location != "Hamburg" {
+		t.Errorf("location after the rejection = %s, want Hamburg", policy.Location)
+	}
+}
+
+func TestApproveInstallmentChange(t *testing.T) {
+	n := newTestNetwork(t)
+	id := lifePolicy(n)
+	policyID := strconv.Itoa(id)
+	before := n.policy(id)
+	n.payPremium(id, strconv.FormatFloat(before.Premium, 'f', -1, 64))
+
+	number := n.mustInvoke("holder", "RequestInstallmentChange", policyID, "8", "")
+	var endorsement Endorsement
+	n.mustInvokeJSON(&endorsement, "underwriter", "ApproveEndorsement", policyID, number)
+
+	policy := n.policy(id)
+	effectiveDate, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Life policies without a package run one year per annual installment
+	wantExpiry := effectiveDate.AddDate(8, 0, 0).Format(time.RFC3339)
+	if policy.InstallmentNo != 8 || policy.TermMonths != 96 || policy.ExpirationDate != wantExpiry || policy.MaturityDate != wantExpiry {
+		t.Errorf("policy has %d installments over %d months until %s, maturing %s, want 8 over 96 months until %s",
+			policy.InstallmentNo, policy.TermMonths, policy.ExpirationDate, policy.MaturityDate, wantExpiry)
+	}
+	if endorsement.PreviousTermMonths != before.TermMonths || endorsement.TermMonths != 96 {
+		t.Errorf("endorsement term %d -> %d months, want %d -> 96", endorsement.PreviousTermMonths, endorsement.TermMonths, before.TermMonths)
+	}
+	if want := (before.TotalPremiumToPay - before.Premium) / 7; policy.Premium != want {
+		t.Errorf("installment premium = %v, want the unpaid premium spread over 7 installments, %v", policy.Premium, want)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Relationships of insured members to the proposer of a floater policy
+const (
+	SelfMember   = "Self"
+	SpouseMember = "Spouse"
+	ChildMember  = "Child"
+	ParentMember = "Parent"
+)
+
+// maxFloaterMembers is the largest family a single floater policy can cover
+const maxFloaterMembers = 6
+
+// maxChildAge is the age up to which children can be covered as dependants
+const maxChildAge = 25
+
+// InsuredMember is a person covered under a family floater policy
+type InsuredMember struct {
+	Name         string `json:"Name"`
+	Relationship string `json:"Relationship"`
+	Age          int    `json:"Age"`
+	// CoveredSince is when a member added after issuance joined the cover; waiting periods of the member run
+	// from it. It is empty for members covered from the start of the policy.
+	CoveredSince string `json:"CoveredSince,omitempty" metadata:",optional"`
+}
+
+// floaterAgeBand loads the base premium by the age of the eldest member
+type floaterAgeBand struct {
+	MaxAge int
+	Factor float64
+}
+
+// floaterAgeBands must be ordered by MaxAge; ages above the last band use its factor
+var floaterAgeBands = []floaterAgeBand{
+	{MaxAge: 35, Factor: 1.0},
+	{MaxAge: 45, Factor: 1.3},
+	{MaxAge: 55, Factor: 1.7},
+	{MaxAge: 65, Factor: 2.4},
+	{MaxAge: 200, Factor: 3.2},
+}
+
+// floaterFamilyFactors loads the base premium by the number of members, indexed by family size
+var floaterFamilyFactors = []float64{0, 1.0, 1.6, 1.9, 2.2, 2.5, 2.8}
+
+// CreateFloaterHealthPolicy issues a health policy whose shared sum insured covers every listed member.
+// The package or calculated premium is loaded by the eldest member's age and the family size.
+func (s *SmartContract) CreateFloaterHealthPolicy(ctx contractapi.TransactionContextInterface, holderName string, location string, companyName string, packageName string, premium float64, installmentNo int, profitPercentage float64, members []InsuredMember) (int, error) {
+	if err := validateMembers(members); err != nil {
+		return 0, err
+	}
+
+	terms, err := s.priceTerms(ctx, packageName, premium, installmentNo, profitPercentage)
+	if err != nil {
+		return 0, err
+	}
+
+	members = append([]InsuredMember{}, members...)
+	for i := range members {
+		members[i].CoveredSince = ""
+	}
+
+	basePremium := terms.Premium
+	terms.Premium *= floaterFactor(members)
+	terms.TotalPremiumToPay = terms.Premium * float64(terms.InstallmentNo)
+
+	return s.issuePolicy(ctx, Policy{
+		HolderName:  holderName,
+		Age:         eldestAge(members),
+		Location:    location,
+		CompanyName: companyName,
+		PolicyType:  HealthPolicy,
+		Members:     members,
+		BasePremium: basePremium,
+	}, terms)
+}
+
+// AddInsuredMember adds a member to an active floater policy and reprices the installments not yet paid.
+// The member's waiting periods run from the day they join, not from the start of the policy.
+func (s *SmartContract) AddInsuredMember(ctx contractapi.TransactionContextInterface, id int, member InsuredMember) error {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if policy.PolicyType != HealthPolicy || len(policy.Members) == 0 {
+		return fmt.Errorf("members can only be added to family floater policies")
+	}
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot add a member to a policy that is not active")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	member.CoveredSince = now.Format(time.RFC3339)
+
+	members := append(append([]InsuredMember{}, policy.Members...), member)
+	if err := validateMembers(members); err != nil {
+		return err
+	}
+
+	policy.Premium = policy.BasePremium * floaterFactor(members)
+	policy.TotalPremiumToPay = policy.TotalPaid + policy.Premium*float64(policy.InstallmentNo-policy.PaymentCount)
+	policy.Members = members
+	policy.Age = eldestAge(members)
+
+	return putPolicy(ctx, policy)
+}
+
+func validateMembers(members []InsuredMember) error {
+	if len(members) == 0 {
+		return fmt.Errorf("a floater policy must cover at least one member")
+	}
+	if len(members) > maxFloaterMembers {
+		return fmt.Errorf("a floater policy can cover at most %d members", maxFloaterMembers)
+	}
+
+	names := make(map[string]bool, len(members))
+	counts := make(map[string]int)
+	for _, member := range members {
+		if member.Name == "" {
+			return fmt.Errorf("member name must not be empty")
+		}
+		if names[member.Name] {
+			return fmt.Errorf("member %s is listed more than once", member.Name)
+		}
+		names[member.Name] = true
+
+		if member.Age < 0 {
+			return fmt.Errorf("age of member %s must not be negative", member.Name)
+		}
+
+		switch member.Relationship {
+		case SelfMember, SpouseMember:
+			if counts[member.Relationship] > 0 {
+				return fmt.Errorf("a floater policy can only cover one %s", member.Relationship)
+			}
+		case ChildMember:
+			if member.Age > maxChildAge {
+				return fmt.Errorf("child %s must be at most %d years old", member.Name, maxChildAge)
+			}
+		case ParentMember:
+		default:
+			return fmt.Errorf("relationship of member %s must be %s, %s, %s or %s", member.Name, SelfMember, SpouseMember, ChildMember, ParentMember)
+		}
+		counts[member.Relationship]++
+	}
+
+	return nil
+}
+
+func floaterFactor(members []InsuredMember) float64 {
+	age := eldestAge(members)
+
+	ageFactor := floaterAgeBands[len(floaterAgeBands)-1].Factor
+	for _, band := range floaterAgeBands {
+		if age <= band.MaxAge {
+			ageFactor = band.Factor
+			break
+		}
+	}
+
+	return ageFactor * floaterFamilyFactors[len(members)]
+}
+
+// rebaseFloaterPremium derives the base premium of a floater policy from a premium set for all its members
+func rebaseFloaterPremium(policy *Policy) {
+	if len(policy.Members) > 0 {
+		policy.BasePremium = policy.Premium / floaterFactor(policy.Members)
+	}
+}
+
+// memberCoverStart returns when the waiting periods of a claim for the named member started:
+// the day the member joined the floater, or the policy's cover start for members covered from the start
+func memberCoverStart(policy *Policy, memberName string) (time.Time, error) {
+	if len(policy.Members) > 0 {
+		member, err := insuredMember(policy, memberName)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if member.CoveredSince != "" {
+			t, err := time.Parse(time.RFC3339, member.CoveredSince)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse cover start date of member %s: %v", memberName, err)
+			}
+			return t, nil
+		}
+	}
+
+	return coverStart(policy)
+}
+
+func eldestAge(members []InsuredMember) int {
+	eldest := 0
+	for _, member := range members {
+		if member.Age > eldest {
+			eldest = member.Age
+		}
+	}
+	return eldest
+}
+
+// insuredMember returns the member of a floater policy with the given name
+func insuredMember(policy *Policy, name string) (*InsuredMember, error) {
+	for i := range policy.Members {
+		if policy.Members[i].Name == name {
+			return &policy.Members[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s is not an insured member of policy %d", name, policy.ID)
+}
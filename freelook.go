@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Declare the default free-look period in days and the setting overriding it
+const (
+	defaultFreeLookPeriodDays = 15
+	freeLookPeriodSetting     = "freeLookPeriodDays"
+)
+
+// Declare the stamp duty kept on a free-look cancellation as a percentage of the premiums paid
+var freeLookStampDutyPercent float64 = 0.2
+
+// FreeLookRefund breaks down the refund paid when a policy is cancelled in the free-look period
+type FreeLookRefund struct {
+	PolicyID     int     `json:"PolicyID"`
+	TotalPaid    float64 `json:"TotalPaid"`
+	StampDuty    float64 `json:"StampDuty"`
+	MedicalCosts float64 `json:"MedicalCosts"`
+	ClaimsPaid   float64 `json:"ClaimsPaid"`
+	Refund       float64 `json:"Refund"`
+}
+
+// CancelInFreeLook cancels a policy within the free-look period measured from its EffectiveDate and
+// refunds the premiums paid minus stamp duty, the medical costs incurred by the insurer and the claims already paid.
+// Only the policy holder and the insurer can cancel a policy.
+func (s *SmartContract) CancelInFreeLook(ctx contractapi.TransactionContextInterface, id int, medicalCosts float64) (*FreeLookRefund, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "cancel it"); err != nil {
+		return nil, err
+	}
+
+	if policy.PolicyStatus != Active {
+		return nil, fmt.Errorf("cannot cancel a policy that is not active")
+	}
+
+	if medicalCosts < 0 {
+		return nil, fmt.Errorf("medical costs must not be negative")
+	}
+	// Only the insurer knows the medical costs it incurred; anyone else cancels without deductions
+	if medicalCosts > 0 {
+		if err := requireMSP(ctx, insurerMSPID, "deduct medical costs"); err != nil {
+			return nil, err
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	effectiveDate, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse effective date: %v", err)
+	}
+
+	days, err := freeLookPeriodDays(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	freeLookEnd := effectiveDate.AddDate(0, 0, days)
+	if now.After(freeLookEnd) {
+		return nil, fmt.Errorf("free-look period ended on %s", freeLookEnd.Format(time.RFC3339))
+	}
+
+	refund := FreeLookRefund{
+		PolicyID:     id,
+		TotalPaid:    policy.TotalPaid,
+		StampDuty:    policy.TotalPaid * freeLookStampDutyPercent / 100,
+		MedicalCosts: medicalCosts,
+		ClaimsPaid:   policy.ClaimsPaid,
+	}
+	refund.Refund = refund.TotalPaid - refund.StampDuty - refund.MedicalCosts - refund.ClaimsPaid
+	if refund.Refund < 0 {
+		refund.Refund = 0
+	}
+
+	// The selling agent gives back the commission earned on the cancelled policy
+	j, err := newJournal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.post(RefundEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(policy), refund.Refund, "Free-look refund"); err != nil {
+		return nil, err
+	}
+	if err := s.clawbackCommissions(ctx, j, policy); err != nil {
+		return nil, err
+	}
+	if err := j.commit(); err != nil {
+		return nil, err
+	}
+	policy.PolicyStatus = FreeLookCancelled
+
+	if err := putPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// GetFreeLookPeriodDays returns the current free-look period in days
+func (s *SmartContract) GetFreeLookPeriodDays(ctx contractapi.TransactionContextInterface) (int, error) {
+	return freeLookPeriodDays(ctx)
+}
+
+// UpdateFreeLookPeriodDays updates the free-look period in days; only administrators can change it
+func (s *SmartContract) UpdateFreeLookPeriodDays(ctx contractapi.TransactionContextInterface, days int) error {
+	if days <= 0 {
+		return fmt.Errorf("free-look period must be greater than 0 days")
+	}
+	return putSetting(ctx, freeLookPeriodSetting, days)
+}
+
+func freeLookPeriodDays(ctx contractapi.TransactionContextInterface) (int, error) {
+	days := defaultFreeLookPeriodDays
+	if err := readSetting(ctx, freeLookPeriodSetting, &days); err != nil {
+		return 0, err
+	}
+	return days, nil
+}
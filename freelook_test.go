@@ -0,0 +1,47 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCancelInFreeLook(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	n.payPremium(id, "1000")
+
+	n.mustFail("stranger", "only the holder of policy", "CancelInFreeLook", strconv.Itoa(id), "0")
+	n.mustFail("holder", "can deduct medical costs", "CancelInFreeLook", strconv.Itoa(id), "100")
+
+	var refund FreeLookRefund
+	n.mustInvokeJSON(&refund, "holder", "CancelInFreeLook", strconv.Itoa(id), "0")
+	if math.Abs(refund.Refund-998) > 1e-9 {
+		t.Errorf("refund = %v, want 1000 less 0.2%% stamp duty", refund.Refund)
+	}
+	if policy := n.policy(id); policy.PolicyStatus != FreeLookCancelled {
+		t.Errorf("policy status = %s, want %s", policy.PolicyStatus, FreeLookCancelled)
+	}
+}
+
+func TestCancelInFreeLookDeductsClaims(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustInvoke("insurer", "UpdateFreeLookPeriodDays", "60")
+	id := n.healthPolicy()
+	// Silver spreads 18 installments over the year, so two are due by the time of the claim
+	n.payPremium(id, "5556")
+	n.payPremium(id, "5556")
+
+	// Silver: 15000 less the 5000 deductible and 20% co-pay pays 8000 once the initial waiting period is over
+	n.advance(31 * 24 * time.Hour)
+	if claim := n.healthClaim(id, `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":15000}`); claim.PaidAmount != 8000 {
+		t.Fatalf("claim paid %v, want 8000", claim.PaidAmount)
+	}
+
+	var refund FreeLookRefund
+	n.mustInvokeJSON(&refund, "holder", "CancelInFreeLook", strconv.Itoa(id), "0")
+	if refund.ClaimsPaid != 8000 || math.Abs(refund.Refund-(11112-22.224-8000)) > 1e-9 {
+		t.Errorf("refund = %v after %v of claims, want premiums less stamp duty and claims", refund.Refund, refund.ClaimsPaid)
+	}
+}
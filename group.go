@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	groupPolicyObjectType      = "GroupPolicy"
+	groupCertificateObjectType = "GroupCertificate"
+	groupInvoiceObjectType     = "GroupInvoice"
+)
+
+// CertificateStatus represents the status of a member certificate under a group policy
+type CertificateStatus string
+
+const (
+	CertificateActive     CertificateStatus = "Active"
+	CertificateTerminated CertificateStatus = "Terminated"
+)
+
+// GroupPolicy is a master policy owned by an employer under which employees are enrolled
+type GroupPolicy struct {
+	ID                 string       `json:"ID"`
+	EmployerName       string       `json:"EmployerName"`
+	Owner              string       `json:"Owner"`
+	CompanyName        string       `json:"CompanyName"`
+	PolicyType         string       `json:"PolicyType"`
+	PremiumPerMember   float64      `json:"PremiumPerMember"`
+	CoveragePerMember  float64      `json:"CoveragePerMember"`
+	PeriodMonths       int          `json:"PeriodMonths"`
+	StartDate          string       `json:"StartDate"`
+	PolicyStatus       PolicyStatus `json:"PolicyStatus"`
+	CertificateCount   int          `json:"CertificateCount"`
+	LastInvoicedPeriod int          `json:"LastInvoicedPeriod"`
+}
+
+// GroupCertificate is the certificate of cover of one member under a group policy
+type GroupCertificate struct {
+	GroupID       string            `json:"GroupID"`
+	CertificateNo int               `json:"CertificateNo"`
+	EmployeeID    string            `json:"EmployeeID"`
+	MemberName    string            `json:"MemberName"`
+	Age           int               `json:"Age"`
+	JoinDate      string            `json:"JoinDate"`
+	LeaveDate     string            `json:"LeaveDate"`
+	Status        CertificateStatus `json:"Status"`
+}
+
+// GroupInvoiceLine is the premium charged for one certificate in an invoice period
+type GroupInvoiceLine struct {
+	CertificateNo int     `json:"CertificateNo"`
+	MemberName    string  `json:"MemberName"`
+	DaysCovered   int     `json:"DaysCovered"`
+	Premium       float64 `json:"Premium"`
+}
+
+// GroupInvoice is the consolidated premium invoice of a group policy for one period.
+// It is a statement of the premium owed, not a payment: nothing is posted to the journal or the treasury until
+// the employer's premium is received.
+type GroupInvoice struct {
+	GroupID     string             `json:"GroupID"`
+	Period      int                `json:"Period"`
+	PeriodStart string             `json:"PeriodStart"`
+	PeriodEnd   string             `json:"PeriodEnd"`
+	Lines       []GroupInvoiceLine `json:"Lines"`
+	Total       float64            `json:"Total"`
+}
+
+// CreateGroupPolicy creates a master policy owned by the calling employer identity.
+// Premiums are charged per member for every period of periodMonths months from the transaction time.
+func (s *SmartContract) CreateGroupPolicy(ctx contractapi.TransactionContextInterface, groupID string, employerName string, companyName string, policyType string, premiumPerMember float64, coveragePerMember float64, periodMonths int) error {
+	if groupID == "" {
+		return fmt.Errorf("group id must not be empty")
+	}
+	if policyType != HealthPolicy && policyType != LifePolicy {
+		return fmt.Errorf("policy type must be %s or %s", HealthPolicy, LifePolicy)
+	}
+	if premiumPerMember <= 0 || coveragePerMember <= 0 {
+		return fmt.Errorf("premium and coverage per member must be greater than zero")
+	}
+	if periodMonths != 1 && periodMonths != 3 && periodMonths != 6 && periodMonths != 12 {
+		return fmt.Errorf("period must be 1, 3, 6 or 12 months")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(groupPolicyObjectType, []string{groupID})
+	if err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read group policy %s: %v", groupID, err)
+	}
+	if existing != nil {
+		return fmt.Errorf("group policy %s already exists", groupID)
+	}
+
+	owner, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	group := GroupPolicy{
+		ID:                groupID,
+		EmployerName:      employerName,
+		Owner:             owner,
+		CompanyName:       companyName,
+		PolicyType:        policyType,
+		PremiumPerMember:  premiumPerMember,
+		CoveragePerMember: coveragePerMember,
+		PeriodMonths:      periodMonths,
+		StartDate:         now.Format(time.RFC3339),
+		PolicyStatus:      Active,
+	}
+
+	return putGroupPolicy(ctx, &group)
+}
+
+// ReadGroupPolicy returns the group policy stored in the ledger with the given id
+func (s *SmartContract) ReadGroupPolicy(ctx contractapi.TransactionContextInterface, groupID string) (*GroupPolicy, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(groupPolicyObjectType, []string{groupID})
+	if err != nil {
+		return nil, err
+	}
+
+	groupJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read group policy %s: %v", groupID, err)
+	}
+	if groupJSON == nil {
+		return nil, fmt.Errorf("group policy %s does not exist", groupID)
+	}
+
+	var group GroupPolicy
+	err = json.Unmarshal(groupJSON, &group)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// EnrollMember issues a certificate under the group policy covering the member from the transaction time
+func (s *SmartContract) EnrollMember(ctx contractapi.TransactionContextInterface, groupID string, employeeID string, memberName string, age int) (*GroupCertificate, error) {
+	group, err := s.ownedGroupPolicy(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	if employeeID == "" || memberName == "" {
+		return nil, fmt.Errorf("employee id and member name must not be empty")
+	}
+
+	certificates, err := s.GetGroupCertificates(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, certificate := range certificates {
+		if certificate.EmployeeID == employeeID && certificate.Status == CertificateActive {
+			return nil, fmt.Errorf("employee %s is already enrolled in group policy %s", employeeID, groupID)
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group.CertificateCount++
+	certificate := GroupCertificate{
+		GroupID:       groupID,
+		CertificateNo: group.CertificateCount,
+		EmployeeID:    employeeID,
+		MemberName:    memberName,
+		Age:           age,
+		JoinDate:      now.Format(time.RFC3339),
+		Status:        CertificateActive,
+	}
+
+	if err := putGroupCertificate(ctx, &certificate); err != nil {
+		return nil, err
+	}
+	if err := putGroupPolicy(ctx, group); err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
+
+// TerminateMember ends the cover of a certificate at the transaction time
+func (s *SmartContract) TerminateMember(ctx contractapi.TransactionContextInterface, groupID string, certificateNo int) error {
+	if _, err := s.ownedGroupPolicy(ctx, groupID); err != nil {
+		return err
+	}
+
+	certificate, err := s.ReadGroupCertificate(ctx, groupID, certificateNo)
+	if err != nil {
+		return err
+	}
+
+	if certificate.Status != CertificateActive {
+		return fmt.Errorf("certificate %d is not active", certificateNo)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	certificate.LeaveDate = now.Format(time.RFC3339)
+	certificate.Status = CertificateTerminated
+
+	return putGroupCertificate(ctx, certificate)
+}
+
+// ReadGroupCertificate returns one member certificate of a group policy
+func (s *SmartContract) ReadGroupCertificate(ctx contractapi.TransactionContextInterface, groupID string, certificateNo int) (*GroupCertificate, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(groupCertificateObjectType, []string{groupID, paddedKey(certificateNo)})
+	if err != nil {
+		return nil, err
+	}
+
+	certificateJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate %d: %v", certificateNo, err)
+	}
+	if certificateJSON == nil {
+		return nil, fmt.Errorf("certificate %d does not exist in group policy %s", certificateNo, groupID)
+	}
+
+	var certificate GroupCertificate
+	err = json.Unmarshal(certificateJSON, &certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
+
+// GetGroupCertificates returns every certificate issued under the group policy
+func (s *SmartContract) GetGroupCertificates(ctx contractapi.TransactionContextInterface, groupID string) ([]GroupCertificate, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(groupCertificateObjectType, []string{groupID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	certificates := []GroupCertificate{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var certificate GroupCertificate
+		err = json.Unmarshal(queryResponse.Value, &certificate)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	return certificates, nil
+}
+
+// GenerateGroupInvoice issues the consolidated invoice of the next period once it has ended. Members who joined
+// or left during the period are charged pro rata for the days they were covered. The invoice only records the
+// premium owed and does not post journal entries, so it does not change account or company balances.
+func (s *SmartContract) GenerateGroupInvoice(ctx contractapi.TransactionContextInterface, groupID string) (*GroupInvoice, error) {
+	group, err := s.ReadGroupPolicy(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	startDate, err := time.Parse(time.RFC3339, group.StartDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start date: %v", err)
+	}
+
+	period := group.LastInvoicedPeriod + 1
+	periodStart := startDate.AddDate(0, (period-1)*group.PeriodMonths, 0)
+	periodEnd := startDate.AddDate(0, period*group.PeriodMonths, 0)
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(periodEnd) {
+		return nil, fmt.Errorf("period %d ends on %s and cannot be invoiced yet", period, periodEnd.Format(time.RFC3339))
+	}
+
+	certificates, err := s.GetGroupCertificates(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := GroupInvoice{
+		GroupID:     groupID,
+		Period:      period,
+		PeriodStart: periodStart.Format(time.RFC3339),
+		PeriodEnd:   periodEnd.Format(time.RFC3339),
+		Lines:       []GroupInvoiceLine{},
+	}
+
+	periodDays := daysBetween(periodStart, periodEnd)
+	for _, certificate := range certificates {
+		days, err := coveredDays(&certificate, periodStart, periodEnd)
+		if err != nil {
+			return nil, err
+		}
+		if days == 0 {
+			continue
+		}
+
+		premium := group.PremiumPerMember * float64(days) / float64(periodDays)
+		invoice.Lines = append(invoice.Lines, GroupInvoiceLine{
+			CertificateNo: certificate.CertificateNo,
+			MemberName:    certificate.MemberName,
+			DaysCovered:   days,
+			Premium:       premium,
+		})
+		invoice.Total += premium
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(groupInvoiceObjectType, []string{groupID, paddedKey(period)})
+	if err != nil {
+		return nil, err
+	}
+
+	invoiceJSON, err := json.Marshal(invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.GetStub().PutState(key, invoiceJSON); err != nil {
+		return nil, err
+	}
+
+	group.LastInvoicedPeriod = period
+	if err := putGroupPolicy(ctx, group); err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// GetGroupInvoices returns every invoice issued for the group policy
+func (s *SmartContract) GetGroupInvoices(ctx contractapi.TransactionContextInterface, groupID string) ([]GroupInvoice, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(groupInvoiceObjectType, []string{groupID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	invoices := []GroupInvoice{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var invoice GroupInvoice
+		err = json.Unmarshal(queryResponse.Value, &invoice)
+		if err != nil {
+			return nil, err
+		}
+		invoices = append(invoices, invoice)
+	}
+
+	return invoices, nil
+}
+
+// ownedGroupPolicy returns an active group policy after checking that the caller is the employer owning it
+func (s *SmartContract) ownedGroupPolicy(ctx contractapi.TransactionContextInterface, groupID string) (*GroupPolicy, error) {
+	group, err := s.ReadGroupPolicy(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if caller != group.Owner {
+		return nil, fmt.Errorf("only the employer owning group policy %s can change its members", groupID)
+	}
+	if group.PolicyStatus != Active {
+		return nil, fmt.Errorf("group policy %s is not active", groupID)
+	}
+
+	return group, nil
+}
+
+// coveredDays returns the number of days in [periodStart, periodEnd) the certificate was in force
+func coveredDays(certificate *GroupCertificate, periodStart time.Time, periodEnd time.Time) (int, error) {
+	from, err := time.Parse(time.RFC3339, certificate.JoinDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse join date of certificate %d: %v", certificate.CertificateNo, err)
+	}
+	if from.Before(periodStart) {
+		from = periodStart
+	}
+
+	to := periodEnd
+	if certificate.LeaveDate != "" {
+		leaveDate, err := time.Parse(time.RFC3339, certificate.LeaveDate)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse leave date of certificate %d: %v", certificate.CertificateNo, err)
+		}
+		if leaveDate.Before(to) {
+			to = leaveDate
+		}
+	}
+
+	if !from.Before(to) {
+		return 0, nil
+	}
+
+	return daysBetween(from, to), nil
+}
+
+// daysBetween counts started days, so a member covered for part of a day pays for that day
+func daysBetween(from time.Time, to time.Time) int {
+	days := int(to.Sub(from) / (24 * time.Hour))
+	if from.Add(time.Duration(days) * 24 * time.Hour).Before(to) {
+		days++
+	}
+	return days
+}
+
+// paddedKey zero-pads numbers so composite keys sort numerically
+func paddedKey(n int) string {
+	return fmt.Sprintf("%08d", n)
+}
+
+func putGroupPolicy(ctx contractapi.TransactionContextInterface, group *GroupPolicy) error {
+	key, err := ctx.GetStub().CreateCompositeKey(groupPolicyObjectType, []string{group.ID})
+	if err != nil {
+		return err
+	}
+
+	groupJSON, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, groupJSON)
+}
+
+func putGroupCertificate(ctx contractapi.TransactionContextInterface, certificate *GroupCertificate) error {
+	key, err := ctx.GetStub().CreateCompositeKey(groupCertificateObjectType, []string{certificate.GroupID, paddedKey(certificate.CertificateNo)})
+	if err != nil {
+		return err
+	}
+
+	certificateJSON, err := json.Marshal(certificate)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, certificateJSON)
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const healthClaimObjectType = "HealthClaim"
+
+// ClaimStatus represents the outcome of a health claim
+type ClaimStatus string
+
+const (
+	// ClaimPending marks claims submitted by the holder and awaiting the insurer's decision
+	ClaimPending  ClaimStatus = "Pending"
+	ClaimApproved ClaimStatus = "Approved"
+	ClaimRejected ClaimStatus = "Rejected"
+)
+
+// Rejection codes explaining why a health claim was not paid
+const (
+	RejectInitialWaitingPeriod     = "InitialWaitingPeriod"
+	RejectConditionWaitingPeriod   = "ConditionWaitingPeriod"
+	RejectPreExistingWaitingPeriod = "PreExistingWaitingPeriod"
+	RejectExcluded                 = "Excluded"
+	// RejectDeclined is used when the insurer declines a claim, for example after reviewing the hospital records
+	RejectDeclined = "Declined"
+)
+
+// HealthTerms are the cost-sharing terms a health claim is adjudicated against
+type HealthTerms struct {
+	// TermMonths is the length of one health cover term, renewed with RenewPolicy
+	TermMonths int `json:"TermMonths"`
+	// SumInsured is available again at the start of every policy year
+	SumInsured float64 `json:"SumInsured"`
+	// Deductible is borne by the insured once per policy year before the insurer pays
+	Deductible   float64 `json:"Deductible"`
+	CoPayPercent float64 `json:"CoPayPercent"`
+	// RoomRentPerDay caps the room charges per hospital day, 0 means no cap
+	RoomRentPerDay float64 `json:"RoomRentPerDay"`
+	// SubLimits caps the treatment charges per procedure code
+	SubLimits map[string]float64 `json:"SubLimits,omitempty" metadata:",optional"`
+	// InitialWaitingDays applies to every claim, ConditionWaitingDays to specific diagnosis codes
+	// and PreExistingWaitingDays to conditions the insured declared before cover started
+	InitialWaitingDays     int            `json:"InitialWaitingDays"`
+	ConditionWaitingDays   map[string]int `json:"ConditionWaitingDays,omitempty" metadata:",optional"`
+	PreExistingWaitingDays int            `json:"PreExistingWaitingDays"`
+	// Exclusions lists diagnosis codes that are never covered
+	Exclusions []string `json:"Exclusions,omitempty" metadata:",optional"`
+}
+
+// CoverUsage tracks how much of the sum insured and deductible was used in one policy year
+type CoverUsage struct {
+	PolicyYear     int     `json:"PolicyYear"`
+	ClaimsPaid     float64 `json:"ClaimsPaid"`
+	DeductibleUsed float64 `json:"DeductibleUsed"`
+}
+
+// HealthClaimRequest describes the hospital bill submitted for a health claim
+type HealthClaimRequest struct {
+	// MemberName identifies the treated member on family floater policies
+	MemberName      string  `json:"MemberName"`
+	DiagnosisCode   string  `json:"DiagnosisCode"`
+	ProcedureCode   string  `json:"ProcedureCode"`
+	RoomDays        int     `json:"RoomDays"`
+	RoomRentPerDay  float64 `json:"RoomRentPerDay"`
+	TreatmentAmount float64 `json:"TreatmentAmount"`
+}
+
+// ClaimRejection explains why a health claim was rejected and, for waiting periods, when it becomes claimable
+type ClaimRejection struct {
+	Code          string `json:"Code"`
+	DiagnosisCode string `json:"DiagnosisCode"`
+	Message       string `json:"Message"`
+	EligibleFrom  string `json:"EligibleFrom"`
+}
+
+// HealthClaim records how a health claim was adjudicated
+type HealthClaim struct {
+	ID               string             `json:"ID"`
+	PolicyID         int                `json:"PolicyID"`
+	PolicyYear       int                `json:"PolicyYear"`
+	Status           ClaimStatus        `json:"Status"`
+	Rejection        *ClaimRejection    `json:"Rejection,omitempty" metadata:",optional"`
+	Request          HealthClaimRequest `json:"Request"`
+	BilledAmount     float64            `json:"BilledAmount"`
+	RoomDisallowed   float64            `json:"RoomDisallowed"`
+	SubLimitExcess   float64            `json:"SubLimitExcess"`
+	AllowedAmount    float64            `json:"AllowedAmount"`
+	Deductible       float64            `json:"Deductible"`
+	CoPay            float64            `json:"CoPay"`
+	SumInsuredExcess float64            `json:"SumInsuredExcess"`
+	PaidAmount       float64            `json:"PaidAmount"`
+	SubmittedAt      string             `json:"SubmittedAt"`
+	DecidedAt        string             `json:"DecidedAt,omitempty" metadata:",optional"`
+}
+
+// RemainingCover shows what is left of a health policy's cover in the current policy year
+type RemainingCover struct {
+	PolicyID            int     `json:"PolicyID"`
+	PolicyYear          int     `json:"PolicyYear"`
+	SumInsured          float64 `json:"SumInsured"`
+	ClaimsPaid          float64 `json:"ClaimsPaid"`
+	RemainingSumInsured float64 `json:"RemainingSumInsured"`
+	RemainingDeductible float64 `json:"RemainingDeductible"`
+}
+
+// SubmitHealthClaim records a hospital bill as a pending claim for the insurer to decide on with ApproveHealthClaim
+// or RejectHealthClaim. Only the policy holder can submit claims, and only while the policy is in force with its
+// premiums paid up to date.
+func (s *SmartContract) SubmitHealthClaim(ctx contractapi.TransactionContextInterface, id int, request HealthClaimRequest) (*HealthClaim, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if policy.HolderID == "" || caller != policy.HolderID {
+		return nil, fmt.Errorf("only the holder of policy %d can submit claims on it", id)
+	}
+
+	if policy.PolicyType != HealthPolicy {
+		return nil, fmt.Errorf("health claims can only be made on health policies")
+	}
+	if policy.PolicyStatus != Active {
+		return nil, fmt.Errorf("cannot claim on a policy that is not active")
+	}
+	if request.RoomDays < 0 || request.RoomRentPerDay < 0 || request.TreatmentAmount < 0 {
+		return nil, fmt.Errorf("claim amounts must not be negative")
+	}
+	if len(policy.Members) > 0 {
+		if _, err := insuredMember(policy, request.MemberName); err != nil {
+			return nil, err
+		}
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkInForce(policy, now); err != nil {
+		return nil, err
+	}
+
+	due, err := installmentsDueBy(policy, now)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.PremiumsWaived && policy.PaymentCount < due {
+		return nil, fmt.Errorf("premiums of policy %d are not paid up: %d of the %d installments due have been paid", id, policy.PaymentCount, due)
+	}
+
+	year, err := policyYear(policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := HealthClaim{
+		ID:          ctx.GetStub().GetTxID(),
+		PolicyID:    id,
+		PolicyYear:  year,
+		Status:      ClaimPending,
+		Request:     request,
+		SubmittedAt: now.Format(time.RFC3339),
+	}
+
+	if err := putHealthClaim(ctx, &claim); err != nil {
+		return nil, err
+	}
+
+	return &claim, nil
+}
+
+// ApproveHealthClaim decides on a pending claim: it checks the diagnosis against the policy's waiting periods and
+// exclusions at the time the claim was submitted, then adjudicates the hospital bill against the room-rent cap,
+// procedure sub-limits, deductible, co-pay and the sum insured remaining in the claim's policy year and pays the
+// result. Claims that are not covered are recorded as rejected with their reason. Only the insurer can approve claims.
+func (s *SmartContract) ApproveHealthClaim(ctx contractapi.TransactionContextInterface, id int, claimID string) (*HealthClaim, error) {
+	if err := requireMSP(ctx, insurerMSPID, "approve health claims"); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claims submitted while the policy was in force are still paid after it expires
+	if policy.PolicyStatus != Active && policy.PolicyStatus != Expired {
+		return nil, fmt.Errorf("cannot pay claims on a policy that is %s", policy.PolicyStatus)
+	}
+
+	submitted, err := pendingHealthClaim(ctx, id, claimID)
+	if err != nil {
+		return nil, err
+	}
+
+	submittedAt, err := time.Parse(time.RFC3339, submitted.SubmittedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse submission date of claim %s: %v", claimID, err)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rejection, err := checkClaimEligibility(policy, submitted.Request.MemberName, submitted.Request.DiagnosisCode, submittedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := coverUsage(policy, submitted.PolicyYear)
+	claim := HealthClaim{Request: submitted.Request, Status: ClaimRejected, Rejection: rejection}
+	if rejection == nil {
+		claim = adjudicateHealthClaim(policy.HealthTerms, *usage, submitted.Request)
+	}
+	claim.ID = submitted.ID
+	claim.PolicyID = id
+	claim.PolicyYear = submitted.PolicyYear
+	claim.SubmittedAt = submitted.SubmittedAt
+	claim.DecidedAt = now.Format(time.RFC3339)
+
+	usage.ClaimsPaid += claim.PaidAmount
+	usage.DeductibleUsed += claim.Deductible
+	if err := postAndCommit(ctx, ClaimEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(policy), claim.PaidAmount, "Health claim"); err != nil {
+		return nil, err
+	}
+	policy.ClaimsPaid += claim.PaidAmount
+
+	if err := putHealthClaim(ctx, &claim); err != nil {
+		return nil, err
+	}
+
+	if err := putPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return &claim, nil
+}
+
+// RejectHealthClaim declines a pending claim with the given reason without paying it.
+// Only the insurer can reject claims.
+func (s *SmartContract) RejectHealthClaim(ctx contractapi.TransactionContextInterface, id int, claimID string, reason string) (*HealthClaim, error) {
+	if err := requireMSP(ctx, insurerMSPID, "reject health claims"); err != nil {
+		return nil, err
+	}
+
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to reject a claim")
+	}
+
+	claim, err := pendingHealthClaim(ctx, id, claimID)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claim.Status = ClaimRejected
+	claim.Rejection = &ClaimRejection{
+		Code:          RejectDeclined,
+		DiagnosisCode: claim.Request.DiagnosisCode,
+		Message:       reason,
+	}
+	claim.DecidedAt = now.Format(time.RFC3339)
+
+	if err := putHealthClaim(ctx, claim); err != nil {
+		return nil, err
+	}
+
+	return claim, nil
+}
+
+// pendingHealthClaim reads a claim of the policy that still awaits the insurer's decision
+func pendingHealthClaim(ctx contractapi.TransactionContextInterface, id int, claimID string) (*HealthClaim, error) {
+	claimKey, err := ctx.GetStub().CreateCompositeKey(healthClaimObjectType, []string{strconv.Itoa(id), claimID})
+	if err != nil {
+		return nil, err
+	}
+
+	claimJSON, err := ctx.GetStub().GetState(claimKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read claim %s: %v", claimID, err)
+	}
+	if claimJSON == nil {
+		return nil, fmt.Errorf("claim %s does not exist on policy %d", claimID, id)
+	}
+
+	var claim HealthClaim
+	if err := json.Unmarshal(claimJSON, &claim); err != nil {
+		return nil, err
+	}
+
+	if claim.Status != ClaimPending {
+		return nil, fmt.Errorf("claim %s has already been %s", claimID, strings.ToLower(string(claim.Status)))
+	}
+
+	return &claim, nil
+}
+
+func putHealthClaim(ctx contractapi.TransactionContextInterface, claim *HealthClaim) error {
+	claimKey, err := ctx.GetStub().CreateCompositeKey(healthClaimObjectType, []string{strconv.Itoa(claim.PolicyID), claim.ID})
+	if err != nil {
+		return err
+	}
+
+	claimJSON, err := json.Marshal(claim)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(claimKey, claimJSON)
+}
+
+// checkInForce returns an error unless the given time falls within the policy's EffectiveDate and ExpirationDate
+func checkInForce(policy *Policy, now time.Time) error {
+	effectiveDate, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		return fmt.Errorf("failed to parse effective date: %v", err)
+	}
+	expirationDate, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+	if err != nil {
+		return fmt.Errorf("failed to parse expiration date: %v", err)
+	}
+
+	if now.Before(effectiveDate) || !now.Before(expirationDate) {
+		return fmt.Errorf("policy %d is not in force, its cover runs from %s until %s", policy.ID, policy.EffectiveDate, policy.ExpirationDate)
+	}
+	return nil
+}
+
+// GetPolicyHealthClaims returns all health claims made on the policy with the given id
+func (s *SmartContract) GetPolicyHealthClaims(ctx contractapi.TransactionContextInterface, id int) ([]HealthClaim, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(healthClaimObjectType, []string{strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	claims := []HealthClaim{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var claim HealthClaim
+		err = json.Unmarshal(queryResponse.Value, &claim)
+		if err != nil {
+			return nil, err
+		}
+		claims = append(claims, claim)
+	}
+
+	return claims, nil
+}
+
+// GetRemainingCover returns the sum insured and deductible left in the current policy year
+func (s *SmartContract) GetRemainingCover(ctx contractapi.TransactionContextInterface, id int) (*RemainingCover, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.PolicyType != HealthPolicy {
+		return nil, fmt.Errorf("remaining cover is only tracked for health policies")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	year, err := policyYear(policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := coverUsage(policy, year)
+	remaining := RemainingCover{
+		PolicyID:            id,
+		PolicyYear:          year,
+		SumInsured:          policy.HealthTerms.SumInsured,
+		ClaimsPaid:          usage.ClaimsPaid,
+		RemainingSumInsured: policy.HealthTerms.SumInsured - usage.ClaimsPaid,
+		RemainingDeductible: policy.HealthTerms.Deductible - usage.DeductibleUsed,
+	}
+	if remaining.RemainingSumInsured < 0 {
+		remaining.RemainingSumInsured = 0
+	}
+	if remaining.RemainingDeductible < 0 {
+		remaining.RemainingDeductible = 0
+	}
+
+	return &remaining, nil
+}
+
+// adjudicateHealthClaim applies the room-rent cap and sub-limit to the bill, then the remaining
+// deductible, the co-pay and finally the remaining sum insured of the policy year
+func adjudicateHealthClaim(terms HealthTerms, usage CoverUsage, request HealthClaimRequest) HealthClaim {
+	claim := HealthClaim{Request: request, Status: ClaimApproved}
+
+	roomCharges := request.RoomRentPerDay * float64(request.RoomDays)
+	claim.BilledAmount = roomCharges + request.TreatmentAmount
+
+	allowedRoom := roomCharges
+	if terms.RoomRentPerDay > 0 && request.RoomRentPerDay > terms.RoomRentPerDay {
+		allowedRoom = terms.RoomRentPerDay * float64(request.RoomDays)
+	}
+	claim.RoomDisallowed = roomCharges - allowedRoom
+
+	allowedTreatment := request.TreatmentAmount
+	if limit, exists := terms.SubLimits[request.ProcedureCode]; exists && allowedTreatment > limit {
+		allowedTreatment = limit
+	}
+	claim.SubLimitExcess = request.TreatmentAmount - allowedTreatment
+
+	claim.AllowedAmount = allowedRoom + allowedTreatment
+
+	claim.Deductible = terms.Deductible - usage.DeductibleUsed
+	if claim.Deductible < 0 {
+		claim.Deductible = 0
+	}
+	if claim.Deductible > claim.AllowedAmount {
+		claim.Deductible = claim.AllowedAmount
+	}
+
+	afterDeductible := claim.AllowedAmount - claim.Deductible
+	claim.CoPay = afterDeductible * terms.CoPayPercent / 100
+	payable := afterDeductible - claim.CoPay
+
+	remaining := terms.SumInsured - usage.ClaimsPaid
+	if remaining < 0 {
+		remaining = 0
+	}
+	if payable > remaining {
+		claim.SumInsuredExcess = payable - remaining
+		payable = remaining
+	}
+	claim.PaidAmount = payable
+
+	return claim
+}
+
+// checkClaimEligibility returns the reason a claim for the diagnosis is not covered at the given time,
+// or nil when it is. Waiting periods are measured from the start of the member's cover, see memberCoverStart.
+func checkClaimEligibility(policy *Policy, memberName string, diagnosisCode string, now time.Time) (*ClaimRejection, error) {
+	terms := policy.HealthTerms
+
+	if containsString(terms.Exclusions, diagnosisCode) {
+		return &ClaimRejection{
+			Code:          RejectExcluded,
+			DiagnosisCode: diagnosisCode,
+			Message:       fmt.Sprintf("diagnosis %s is excluded from cover", diagnosisCode),
+		}, nil
+	}
+
+	coverStart, err := memberCoverStart(policy, memberName)
+	if err != nil {
+		return nil, err
+	}
+
+	waits := []struct {
+		code    string
+		days    int
+		applies bool
+		message string
+	}{
+		{RejectInitialWaitingPeriod, terms.InitialWaitingDays, true, "initial waiting period has not ended"},
+		{RejectPreExistingWaitingPeriod, terms.PreExistingWaitingDays, containsString(policy.PreExistingConditions, diagnosisCode), fmt.Sprintf("waiting period for pre-existing condition %s has not ended", diagnosisCode)},
+		{RejectConditionWaitingPeriod, terms.ConditionWaitingDays[diagnosisCode], true, fmt.Sprintf("waiting period for condition %s has not ended", diagnosisCode)},
+	}
+
+	for _, wait := range waits {
+		if !wait.applies || wait.days <= 0 {
+			continue
+		}
+
+		eligibleFrom := coverStart.AddDate(0, 0, wait.days)
+		if now.Before(eligibleFrom) {
+			return &ClaimRejection{
+				Code:          wait.code,
+				DiagnosisCode: diagnosisCode,
+				Message:       wait.message,
+				EligibleFrom:  eligibleFrom.Format(time.RFC3339),
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// DeclarePreExistingConditions records the diagnosis codes the insured declared as pre-existing.
+// Only the insurer can record declarations, and only before the first premium and the first health claim.
+// Declarations are added to those already recorded and never replace them.
+func (s *SmartContract) DeclarePreExistingConditions(ctx contractapi.TransactionContextInterface, id int, diagnosisCodes []string) error {
+	if err := requireMSP(ctx, insurerMSPID, "record pre-existing conditions"); err != nil {
+		return err
+	}
+
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if policy.PolicyType != HealthPolicy {
+		return fmt.Errorf("pre-existing conditions can only be declared on health policies")
+	}
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot declare conditions on a policy that is not active")
+	}
+	if policy.PaymentCount > 0 {
+		return fmt.Errorf("pre-existing conditions cannot be declared after the first premium has been paid")
+	}
+	if len(diagnosisCodes) == 0 {
+		return fmt.Errorf("no diagnosis codes declared")
+	}
+
+	claims, err := s.GetPolicyHealthClaims(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(claims) > 0 {
+		return fmt.Errorf("pre-existing conditions cannot be declared after a claim has been made")
+	}
+
+	for _, code := range diagnosisCodes {
+		if code == "" {
+			return fmt.Errorf("diagnosis codes must not be empty")
+		}
+		if !containsString(policy.PreExistingConditions, code) {
+			policy.PreExistingConditions = append(policy.PreExistingConditions, code)
+		}
+	}
+
+	return putPolicy(ctx, policy)
+}
+
+// coverUsage returns the usage record of the given policy year, adding it to the policy when missing
+func coverUsage(policy *Policy, year int) *CoverUsage {
+	for i := range policy.CoverUsage {
+		if policy.CoverUsage[i].PolicyYear == year {
+			return &policy.CoverUsage[i]
+		}
+	}
+
+	policy.CoverUsage = append(policy.CoverUsage, CoverUsage{PolicyYear: year})
+	return &policy.CoverUsage[len(policy.CoverUsage)-1]
+}
+
+// policyYear returns the 1-based policy year the given time falls in, counted from the EffectiveDate
+func policyYear(policy *Policy, now time.Time) (int, error) {
+	effectiveDate, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse effective date: %v", err)
+	}
+
+	year := 1
+	for !now.Before(effectiveDate.AddDate(year, 0, 0)) {
+		year++
+	}
+
+	return year, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHealthClaimAdjudication(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	n.payPremium(id, "11112")
+	n.payPremium(id, "11112")
+	n.advance(31 * 24 * time.Hour)
+
+	tests := []struct {
+		name    string
+		request string
+		want    HealthClaim
+	}{
+		{
+			// 18000 billed, 2000 room rent over the 3000 cap, 5000 deductible and 20% co-pay
+			name:    "room rent cap and deductible",
+			request: `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":2,"RoomRentPerDay":4000,"TreatmentAmount":10000}`,
+			want:    HealthClaim{Status: ClaimApproved, BilledAmount: 18000, RoomDisallowed: 2000, AllowedAmount: 16000, Deductible: 5000, CoPay: 2200, PaidAmount: 8800},
+		},
+		{
+			// The deductible is used up for the policy year, the knee replacement is capped at 150000
+			name:    "procedure sub-limit",
+			request: `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"KNEE_REPLACEMENT","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":200000}`,
+			want:    HealthClaim{Status: ClaimApproved, BilledAmount: 200000, SubLimitExcess: 50000, AllowedAmount: 150000, CoPay: 30000, PaidAmount: 120000},
+		},
+		{
+			name:    "condition waiting period",
+			request: `{"MemberName":"","DiagnosisCode":"CATARACT","ProcedureCode":"CATARACT","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":30000}`,
+			want:    HealthClaim{Status: ClaimRejected},
+		},
+	}
+
+	for _, test := range tests {
+		claim := n.healthClaim(id, test.request)
+		got := HealthClaim{
+			Status:         claim.Status,
+			BilledAmount:   claim.BilledAmount,
+			RoomDisallowed: claim.RoomDisallowed,
+			SubLimitExcess: claim.SubLimitExcess,
+			AllowedAmount:  claim.AllowedAmount,
+			Deductible:     claim.Deductible,
+			CoPay:          claim.CoPay,
+			PaidAmount:     claim.PaidAmount,
+		}
+		if got != test.want {
+			t.Errorf("%s: claim = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	var remaining RemainingCover
+	n.mustInvokeJSON(&remaining, "holder", "GetRemainingCover", strconv.Itoa(id))
+	if remaining.ClaimsPaid != 128800 || remaining.RemainingSumInsured != 540000-128800 || remaining.RemainingDeductible != 0 {
+		t.Errorf("remaining cover = %+v, want 128800 paid and no deductible left", remaining)
+	}
+}
+
+func TestHealthClaimDecision(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+	n.payPremium(id, "11112")
+	request := `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":15000}`
+
+	n.mustFail("stranger", "only the holder of policy", "SubmitHealthClaim", policyID, request)
+
+	var claim HealthClaim
+	n.mustInvokeJSON(&claim, "holder", "SubmitHealthClaim", policyID, request)
+	if claim.Status != ClaimPending || claim.PaidAmount != 0 {
+		t.Fatalf("submitted claim is %s with %v paid, want a pending claim", claim.Status, claim.PaidAmount)
+	}
+
+	n.mustFail("holder", "only members of Org1MSP can approve health claims", "ApproveHealthClaim", policyID, claim.ID)
+	n.mustFail("holder", "only members of Org1MSP can reject health claims", "RejectHealthClaim", policyID, claim.ID, "no")
+	n.mustFail("insurer", "a reason is required", "RejectHealthClaim", policyID, claim.ID, "")
+
+	n.mustInvokeJSON(&claim, "insurer", "RejectHealthClaim", policyID, claim.ID, "treatment not medically necessary")
+	if claim.Status != ClaimRejected || claim.Rejection == nil || claim.Rejection.Code != RejectDeclined {
+		t.Errorf("rejected claim = %+v, want it declined", claim)
+	}
+	n.mustFail("insurer", "has already been rejected", "ApproveHealthClaim", policyID, claim.ID)
+
+	if policy := n.policy(id); policy.ClaimsPaid != 0 {
+		t.Errorf("claims paid = %v after a rejected claim, want 0", policy.ClaimsPaid)
+	}
+}
+
+func TestHealthClaimRequiresCoverInForce(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+	request := `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":15000}`
+
+	n.mustFail("holder", "not paid up: 0 of the 1 installments due", "SubmitHealthClaim", policyID, request)
+	n.payPremium(id, "11112")
+	n.mustInvoke("holder", "SubmitHealthClaim", policyID, request)
+
+	// Silver's second installment falls due about 20 days into the year
+	n.advance(25 * 24 * time.Hour)
+	n.mustFail("holder", "not paid up: 1 of the 2 installments due", "SubmitHealthClaim", policyID, request)
+
+	n.advance(365 * 24 * time.Hour)
+	n.mustFail("holder", "is not in force", "SubmitHealthClaim", policyID, request)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// guaranteedSurrenderFactors is the share of premiums paid that is guaranteed on surrender,
+// indexed by policy year starting at year 1; the last factor applies to later years
+var guaranteedSurrenderFactors = []float64{0, 0.30, 0.30, 0.50, 0.50, 0.50, 0.50, 0.90}
+
+// IllustrationRow shows the benefits of a life policy at the end of one policy year
+type IllustrationRow struct {
+	Year                     int       `json:"Year"`
+	PremiumsPaidToDate       float64   `json:"PremiumsPaidToDate"`
+	GuaranteedSurrenderValue float64   `json:"GuaranteedSurrenderValue"`
+	ProjectedValues          []float64 `json:"ProjectedValues"`
+	DeathBenefit             float64   `json:"DeathBenefit"`
+}
+
+// BenefitIllustration is a year by year table of what a life policy pays, with the
+// projected values given in the same order as AssumedRates
+type BenefitIllustration struct {
+	PolicyID           int               `json:"PolicyID"`
+	QuoteID            string            `json:"QuoteID"`
+	PackageName        string            `json:"PackageName"`
+	Premium            float64           `json:"Premium"`
+	InstallmentNo      int               `json:"InstallmentNo"`
+	GuaranteedMaturity float64           `json:"GuaranteedMaturity"`
+	AssumedRates       []float64         `json:"AssumedRates"`
+	Rows               []IllustrationRow `json:"Rows"`
+}
+
+// GetBenefitIllustration returns the benefit illustration of an existing life policy
+func (s *SmartContract) GetBenefitIllustration(ctx contractapi.TransactionContextInterface, id int, assumedRates []float64) (*BenefitIllustration, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.PolicyType != LifePolicy {
+		return nil, fmt.Errorf("benefit illustrations are only available for life policies")
+	}
+
+	illustration, err := s.illustrate(ctx, policy.Premium, policy.InstallmentNo, policy.Coverage, assumedRates)
+	if err != nil {
+		return nil, err
+	}
+	illustration.PolicyID = policy.ID
+	illustration.PackageName = policy.PackageName
+
+	return illustration, nil
+}
+
+// GetQuoteBenefitIllustration returns the benefit illustration of a hypothetical life policy priced by a quote
+func (s *SmartContract) GetQuoteBenefitIllustration(ctx contractapi.TransactionContextInterface, quoteID string, assumedRates []float64) (*BenefitIllustration, error) {
+	quote, err := s.ReadQuote(ctx, quoteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if quote.PolicyType != LifePolicy {
+		return nil, fmt.Errorf("benefit illustrations are only available for life policies")
+	}
+
+	illustration, err := s.illustrate(ctx, quote.Terms.Premium, quote.Terms.InstallmentNo, quote.Terms.Coverage, assumedRates)
+	if err != nil {
+		return nil, err
+	}
+	illustration.QuoteID = quote.ID
+	illustration.PackageName = quote.Terms.PackageName
+
+	return illustration, nil
+}
+
+// illustrate builds the yearly rows, projecting the premiums paid to date with CalculateMaturity at each assumed rate
+func (s *SmartContract) illustrate(ctx contractapi.TransactionContextInterface, premium float64, installmentNo int, coverage float64, assumedRates []float64) (*BenefitIllustration, error) {
+	if len(assumedRates) < 2 {
+		return nil, fmt.Errorf("at least two assumed rates are required")
+	}
+	for _, rate := range assumedRates {
+		if rate <= 0 {
+			return nil, fmt.Errorf("assumed rates must be greater than zero")
+		}
+	}
+
+	illustration := BenefitIllustration{
+		Premium:            premium,
+		InstallmentNo:      installmentNo,
+		GuaranteedMaturity: coverage,
+		AssumedRates:       assumedRates,
+		Rows:               []IllustrationRow{},
+	}
+
+	for year := 1; year <= installmentNo; year++ {
+		paid := premium * float64(year)
+
+		projected := make([]float64, len(assumedRates))
+		for i, rate := range assumedRates {
+			projected[i] = s.CalculateMaturity(ctx, premium, year, rate)
+		}
+
+		deathBenefit := coverage
+		if paid > deathBenefit {
+			deathBenefit = paid
+		}
+
+		illustration.Rows = append(illustration.Rows, IllustrationRow{
+			Year:                     year,
+			PremiumsPaidToDate:       paid,
+			GuaranteedSurrenderValue: paid * guaranteedSurrenderFactor(year),
+			ProjectedValues:          projected,
+			DeathBenefit:             deathBenefit,
+		})
+	}
+
+	return &illustration, nil
+}
+
+func guaranteedSurrenderFactor(year int) float64 {
+	if year < 1 {
+		return 0
+	}
+	if year > len(guaranteedSurrenderFactors) {
+		return guaranteedSurrenderFactors[len(guaranteedSurrenderFactors)-1]
+	}
+	return guaranteedSurrenderFactors[year-1]
+}
@@ -20,32 +20,77 @@ type SmartContract struct {
 type PolicyStatus string
 
 const (
-	Active    PolicyStatus = "Active"
-	Cancelled PolicyStatus = "Cancelled"
-	Claimed   PolicyStatus = "Claimed"
-	Expired   PolicyStatus = "Expired"
+	Active      PolicyStatus = "Active"
+	Cancelled   PolicyStatus = "Cancelled"
+	Claimed     PolicyStatus = "Claimed"
+	Expired     PolicyStatus = "Expired"
+	Surrendered PolicyStatus = "Surrendered"
+	Matured     PolicyStatus = "Matured"
+	// FreeLookCancelled marks policies cancelled for a refund within the free-look period
+	FreeLookCancelled PolicyStatus = "FreeLookCancelled"
+)
+
+// Policy types issued by the contract
+const (
+	HealthPolicy = "Health"
+	LifePolicy   = "life"
 )
 
 // Policy describes basic details of what makes up an insurance policy
 type Policy struct {
-	ID                int          `json:"ID"`
-	HolderName        string       `json:"HolderName"`
-	Age               int          `json:"Age"`
-	Location          string       `json:"Location"`
-	CompanyName       string       `json:"CompanyName"`
-	PolicyType        string       `json:"PolicyType"`
-	PackageName       string       `json:"PackageName"`
-	Premium           float64      `json:"Premium"`
-	Coverage          float64      `json:"Coverage"`
-	EffectiveDate     string       `json:"EffectiveDate"`
-	ExpirationDate    string       `json:"ExpirationDate"`
-	TotalPaid         float64      `json:"TotalPaid"`
-	PaymentCount      int          `json:"PaymentCount"`
-	LastPaymentTime   time.Time    `json:"LastPaymentTime"`
-	UserBalance       float64      `json:"UserBalance"`
-	PolicyStatus      PolicyStatus `json:"PolicyStatus"`
-	InstallmentNo     int          `json:"InstallmentNo"`
-	TotalPremiumToPay float64      `json:"TotalPremiumToPay"`
+	ID                int           `json:"ID"`
+	HolderName        string        `json:"HolderName"`
+	Age               int           `json:"Age"`
+	Location          string        `json:"Location"`
+	CompanyName       string        `json:"CompanyName"`
+	PolicyType        string        `json:"PolicyType"`
+	PackageName       string        `json:"PackageName"`
+	Premium           float64       `json:"Premium"`
+	Coverage          float64       `json:"Coverage"`
+	EffectiveDate     string        `json:"EffectiveDate"`
+	ExpirationDate    string        `json:"ExpirationDate"`
+	TermMonths        int           `json:"TermMonths"`
+	MaturityDate      string        `json:"MaturityDate"`
+	TotalPaid         float64       `json:"TotalPaid"`
+	PaymentCount      int           `json:"PaymentCount"`
+	LastPaymentTime   time.Time     `json:"LastPaymentTime"`
+	PolicyStatus      PolicyStatus  `json:"PolicyStatus"`
+	InstallmentNo     int           `json:"InstallmentNo"`
+	TotalPremiumToPay float64       `json:"TotalPremiumToPay"`
+	Gender            string        `json:"Gender"`
+	LifeProduct       LifeProduct   `json:"LifeProduct"`
+	MortalityTableID  string        `json:"MortalityTableID"`
+	MaturityModel     MaturityModel `json:"MaturityModel"`
+	ClaimsPaid        float64       `json:"ClaimsPaid"`
+	MaturityPaid      float64       `json:"MaturityPaid"`
+	Beneficiaries     []Beneficiary `json:"Beneficiaries,omitempty" metadata:",optional"`
+	Riders            []Rider       `json:"Riders,omitempty" metadata:",optional"`
+	PremiumsWaived    bool          `json:"PremiumsWaived"`
+	HealthTerms       HealthTerms   `json:"HealthTerms"`
+	CoverUsage        []CoverUsage  `json:"CoverUsage,omitempty" metadata:",optional"`
+	// PreExistingConditions holds the diagnosis codes declared by the insured
+	PreExistingConditions []string `json:"PreExistingConditions,omitempty" metadata:",optional"`
+	// Members lists everyone covered by a family floater policy and is empty for individual policies
+	Members []InsuredMember `json:"Members,omitempty" metadata:",optional"`
+	// BasePremium is the installment premium of a floater policy before loading by its members' ages and family size
+	BasePremium float64 `json:"BasePremium"`
+	// HolderID is the client identity of the policy holder; their customer account is keyed by it
+	HolderID string `json:"HolderID"`
+	// AccountID is the customer account receiving payouts, see customerAccountRef
+	AccountID string `json:"AccountID"`
+	// AgentID is the agent or broker who sold the policy and earns commission on its premiums
+	AgentID string `json:"AgentID"`
+	// RenewalOf and RenewedBy link the consecutive terms of a renewed policy; waiting periods are measured
+	// from ContinuousCoverSince, the start of the first term, when it is set
+	RenewalOf            int    `json:"RenewalOf"`
+	RenewedBy            int    `json:"RenewedBy"`
+	ContinuousCoverSince string `json:"ContinuousCoverSince"`
+	// NoClaimsBonus is the bonus earned by claim-free terms and applied to this term
+	NoClaimsBonus NoClaimsBonus `json:"NoClaimsBonus"`
+	// EndorsementCount is the number of the latest endorsement requested on the policy
+	EndorsementCount int `json:"EndorsementCount"`
+	// Version counts the writes of the policy, so PatchPolicy can refuse changes based on a stale read
+	Version int `json:"Version"`
 }
 
 // Declare a default profit percentage
@@ -54,20 +99,66 @@ var profitPercentageDefault float64 = 13
 const counterKey = "policyCounter"
 
 var packages = map[string]Policy{
+	// A package with a MaturityModel derives its coverage from it; otherwise Coverage is used as is.
+	// The MaturityModel is recorded on every policy issued from the package.
+	// HealthTerms only apply to health policies; a zero SumInsured defaults to the coverage.
+	// TermMonths is the term of life policies, HealthTerms.TermMonths the term of health policies.
+	// Life policies are priced from the package's mortality table with Coverage as the sum assured.
 	"Silver": {
-		Premium:       11112,
-		InstallmentNo: 18,
-		Coverage:      540000,
+		Premium:          11112,
+		InstallmentNo:    18,
+		MaturityModel:    MaturityModel{Type: CompoundInterestModel, Rate: 9.7, CompoundingPerYear: 1},
+		TermMonths:       216,
+		LifeProduct:      EndowmentLife,
+		MortalityTableID: standardMortalityTableID,
+		HealthTerms: HealthTerms{
+			TermMonths:             12,
+			SumInsured:             540000,
+			Deductible:             5000,
+			CoPayPercent:           20,
+			RoomRentPerDay:         3000,
+			SubLimits:              map[string]float64{"CATARACT": 40000, "KNEE_REPLACEMENT": 150000},
+			InitialWaitingDays:     30,
+			ConditionWaitingDays:   map[string]int{"CATARACT": 730, "HERNIA": 730, "KNEE_REPLACEMENT": 1095},
+			PreExistingWaitingDays: 1460,
+			Exclusions:             []string{"COSMETIC", "INFERTILITY", "SELF_INFLICTED_INJURY"},
+		},
 	},
 	"Gold": {
-		Premium:       10000,
-		InstallmentNo: 20,
-		Coverage:      800000,
+		Premium:          10000,
+		InstallmentNo:    20,
+		MaturityModel:    MaturityModel{Type: CompoundInterestModel, Rate: 11.4, CompoundingPerYear: 4},
+		TermMonths:       240,
+		LifeProduct:      EndowmentLife,
+		MortalityTableID: standardMortalityTableID,
+		HealthTerms: HealthTerms{
+			TermMonths:             12,
+			SumInsured:             800000,
+			Deductible:             2500,
+			CoPayPercent:           10,
+			RoomRentPerDay:         5000,
+			SubLimits:              map[string]float64{"CATARACT": 60000, "KNEE_REPLACEMENT": 250000},
+			InitialWaitingDays:     30,
+			ConditionWaitingDays:   map[string]int{"CATARACT": 365, "HERNIA": 365, "KNEE_REPLACEMENT": 730},
+			PreExistingWaitingDays: 1095,
+			Exclusions:             []string{"COSMETIC", "SELF_INFLICTED_INJURY"},
+		},
 	},
 	"Platinum": {
-		Premium:       13087,
-		InstallmentNo: 25,
-		Coverage:      1410000,
+		Premium:          13087,
+		InstallmentNo:    25,
+		MaturityModel:    MaturityModel{Type: GuaranteedPlusBonusModel, GuaranteedRate: 8, BonusRate: 8.86},
+		TermMonths:       300,
+		LifeProduct:      EndowmentLife,
+		MortalityTableID: standardMortalityTableID,
+		HealthTerms: HealthTerms{
+			TermMonths:             12,
+			SumInsured:             1410000,
+			RoomRentPerDay:         10000,
+			InitialWaitingDays:     30,
+			PreExistingWaitingDays: 730,
+			Exclusions:             []string{"COSMETIC"},
+		},
 	},
 	// Add more packages as needed
 }
@@ -91,31 +182,13 @@ func (s *SmartContract) GetInstallmentNo(ctx contractapi.TransactionContextInter
 	return policy.InstallmentNo, nil
 }
 
-func (s *SmartContract) SetInstallmentNo(ctx contractapi.TransactionContextInterface, id int, newInstallmentNo int) error {
-	if newInstallmentNo <= 0 {
-		return fmt.Errorf("installment number must be greater than zero")
-	}
-
-	// Retrieve the policy
-	policy, err := s.ReadPolicy(ctx, id)
-	if err != nil {
-		return err
-	}
-
-	// Update the InstallmentNo field
-	policy.InstallmentNo = newInstallmentNo
-
-	// Marshal the updated policy to JSON
-	policyJSON, err := json.Marshal(policy)
-	if err != nil {
-		return err
-	}
-
-	// Store the updated policy in the ledger
-	return ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
+func (s *SmartContract) getNextID(ctx contractapi.TransactionContextInterface) (int, error) {
+	return s.reserveIDs(ctx, 1)
 }
 
-func (s *SmartContract) getNextID(ctx contractapi.TransactionContextInterface) (int, error) {
+// reserveIDs advances the counter by n and returns the first reserved id. Reads within a
+// transaction do not see its own writes, so callers issuing several policies must reserve them at once.
+func (s *SmartContract) reserveIDs(ctx contractapi.TransactionContextInterface, n int) (int, error) {
 	counterBytes, err := ctx.GetStub().GetState(counterKey)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get counter: %v", err)
@@ -131,144 +204,171 @@ func (s *SmartContract) getNextID(ctx contractapi.TransactionContextInterface) (
 	}
 
 	// Increment the counter
-	counter++
-	if err := ctx.GetStub().PutState(counterKey, []byte(strconv.Itoa(counter))); err != nil {
+	if err := ctx.GetStub().PutState(counterKey, []byte(strconv.Itoa(counter+n))); err != nil {
 		return 0, fmt.Errorf("failed to update counter: %v", err)
 	}
 
-	return counter, nil
+	return counter + 1, nil
 }
 
 // CreateHealthInsurancePolicy adds a new health insurance policy to the ledger
 func (s *SmartContract) CreateHealthInsurancePolicy(ctx contractapi.TransactionContextInterface, holderName string, age int, location string, companyName string, packageName string, premium float64, installmentNo int, profitPercentage float64) error {
-
-	var coverage float64
-	var totalPremiumToPay float64
-
-	// Check if a packageName is provided and if it exists in the predefined packages
-	if packageName != "" {
-		insurancePackage, exists := packages[packageName]
-		if exists {
-			premium = insurancePackage.Premium
-			coverage = insurancePackage.Coverage
-			installmentNo = insurancePackage.InstallmentNo
-			totalPremiumToPay = premium * float64(installmentNo)
-		} else {
-			return fmt.Errorf("package %s does not exist", packageName)
-		}
-	} else {
-		// Call CalculateMaturity to determine the coverage if packageName is not provided
-		coverage = s.CalculateMaturity(ctx, premium, installmentNo, profitPercentage)
-		totalPremiumToPay = premium * float64(installmentNo)
-	}
-
-	// Get the next policy ID
-	id, err := s.getNextID(ctx)
-	if err != nil {
-		return err
-	}
-
-	// Get the current timestamp
-	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	terms, err := s.priceTerms(ctx, packageName, premium, installmentNo, profitPercentage)
 	if err != nil {
 		return err
 	}
 
-	effectiveDate := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
-	expirationDate := effectiveDate.Add(5 * time.Minute) // Adjust as necessary
-
-	// Create the policy using the provided or default values
-	policy := Policy{
-		ID:                id,
-		HolderName:        holderName,
-		Age:               age,
-		Location:          location,
-		CompanyName:       companyName,
-		PolicyType:        "Health",
-		PackageName:       packageName,
-		Premium:           premium,
-		Coverage:          coverage,
-		EffectiveDate:     effectiveDate.Format(time.RFC3339),
-		ExpirationDate:    expirationDate.Format(time.RFC3339),
-		TotalPaid:         0,
-		PolicyStatus:      Active,
-		InstallmentNo:     installmentNo,
-		TotalPremiumToPay: totalPremiumToPay,
-	}
+	_, err = s.issuePolicy(ctx, Policy{
+		HolderName:  holderName,
+		Age:         age,
+		Location:    location,
+		CompanyName: companyName,
+		PolicyType:  HealthPolicy,
+	}, terms)
+	return err
+}
 
-	policyJSON, err := json.Marshal(policy)
+// CreateLifeInsurancePolicy adds a new life insurance policy to the ledger, priced from a mortality table
+// for the insured's age and gender. A package supplies the product, table, sum assured and term.
+func (s *SmartContract) CreateLifeInsurancePolicy(ctx contractapi.TransactionContextInterface, holderName string, age int, gender string, location string, companyName string, packageName string, product string, tableID string, sumAssured float64, termYears int, interestRate float64) error {
+	terms, err := s.priceLifeTerms(ctx, packageName, gender, age, product, tableID, sumAssured, termYears, interestRate)
 	if err != nil {
 		return err
 	}
 
-	// Store the policy in the ledger
-	return ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
+	_, err = s.issuePolicy(ctx, Policy{
+		HolderName:  holderName,
+		Age:         age,
+		Gender:      gender,
+		Location:    location,
+		CompanyName: companyName,
+		PolicyType:  LifePolicy,
+	}, terms)
+	return err
 }
 
-// CreateLifeInsurancePolicy adds a new life insurance policy to the ledger
-func (s *SmartContract) CreateLifeInsurancePolicy(ctx contractapi.TransactionContextInterface, holderName string, age int, location string, companyName string, packageName string, premium float64, installmentNo int, profitPercentage float64) error {
+// PricedTerms holds the premium, coverage and installment plan a policy is issued with
+type PricedTerms struct {
+	PackageName       string        `json:"PackageName"`
+	Premium           float64       `json:"Premium"`
+	Coverage          float64       `json:"Coverage"`
+	InstallmentNo     int           `json:"InstallmentNo"`
+	TotalPremiumToPay float64       `json:"TotalPremiumToPay"`
+	MaturityModel     MaturityModel `json:"MaturityModel"`
+	HealthTerms       HealthTerms   `json:"HealthTerms"`
+	// TermMonths of zero is derived from the policy type when the policy is issued, see fillTermMonths
+	TermMonths int `json:"TermMonths"`
+	// LifeProduct and MortalityTableID record how a life policy was priced, see priceLifeTerms
+	LifeProduct      LifeProduct `json:"LifeProduct"`
+	MortalityTableID string      `json:"MortalityTableID"`
+}
 
-	var coverage float64
-	var totalPremiumToPay float64
+// priceTerms resolves the terms for a package, or calculates them from the premium when no package is given
+func (s *SmartContract) priceTerms(ctx contractapi.TransactionContextInterface, packageName string, premium float64, installmentNo int, profitPercentage float64) (PricedTerms, error) {
+	terms := PricedTerms{PackageName: packageName}
 
 	// Check if a packageName is provided and if it exists in the predefined packages
 	if packageName != "" {
 		insurancePackage, exists := packages[packageName]
-		if exists {
-			premium = insurancePackage.Premium
-			coverage = insurancePackage.Coverage
-			installmentNo = insurancePackage.InstallmentNo
-			totalPremiumToPay = premium * float64(installmentNo)
-		} else {
-			return fmt.Errorf("package %s does not exist", packageName)
+		if !exists {
+			return terms, fmt.Errorf("package %s does not exist", packageName)
+		}
+		terms.Premium = insurancePackage.Premium
+		terms.Coverage = insurancePackage.Coverage
+		terms.InstallmentNo = insurancePackage.InstallmentNo
+		terms.MaturityModel = insurancePackage.MaturityModel
+		terms.HealthTerms = insurancePackage.HealthTerms
+
+		if terms.MaturityModel.Type != "" {
+			coverage, err := terms.MaturityModel.maturityValue(terms.Premium, terms.InstallmentNo)
+			if err != nil {
+				return terms, fmt.Errorf("package %s: %v", packageName, err)
+			}
+			terms.Coverage = coverage
 		}
 	} else {
 		// Call CalculateMaturity to determine the coverage if packageName is not provided
-		coverage = s.CalculateMaturity(ctx, premium, installmentNo, profitPercentage)
-		totalPremiumToPay = premium * float64(installmentNo)
+		terms.Premium = premium
+		terms.Coverage = s.CalculateMaturity(ctx, premium, installmentNo, profitPercentage)
+		terms.InstallmentNo = installmentNo
+		terms.MaturityModel = defaultMaturityModel(profitPercentage)
 	}
+	terms.TotalPremiumToPay = terms.Premium * float64(terms.InstallmentNo)
+	if terms.HealthTerms.SumInsured == 0 {
+		terms.HealthTerms.SumInsured = terms.Coverage
+	}
+
+	return terms, nil
+}
 
+// issuePolicy stores a new policy with already priced terms and returns its id.
+// The given policy supplies the holder details; identity, dates, status and terms are filled in here.
+func (s *SmartContract) issuePolicy(ctx contractapi.TransactionContextInterface, policy Policy, terms PricedTerms) (int, error) {
 	// Get the next policy ID
 	id, err := s.getNextID(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// Get the current timestamp
-	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	effectiveDate, err := txTime(ctx)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	// The caller takes out the policy
+	policy.HolderID, err = ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client identity: %v", err)
 	}
 
-	effectiveDate := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
-	expirationDate := effectiveDate.Add(5 * time.Minute) // Adjust as necessary
-
-	// Create the policy using the provided or default values
-	policy := Policy{
-		ID:                id,
-		HolderName:        holderName,
-		Age:               age,
-		Location:          location,
-		CompanyName:       companyName,
-		PolicyType:        "life",
-		PackageName:       packageName,
-		Premium:           premium,
-		Coverage:          coverage,
-		EffectiveDate:     effectiveDate.Format(time.RFC3339),
-		ExpirationDate:    expirationDate.Format(time.RFC3339),
-		TotalPaid:         0,
-		PolicyStatus:      Active,
-		InstallmentNo:     installmentNo,
-		TotalPremiumToPay: totalPremiumToPay,
+	if err := fillTermMonths(ctx, policy.PolicyType, &terms); err != nil {
+		return 0, err
 	}
 
-	policyJSON, err := json.Marshal(policy)
+	policy = newPolicy(id, effectiveDate, policy, terms)
+
+	// Store the policy in the ledger
+	return id, putPolicy(ctx, &policy)
+}
+
+// newPolicy fills in the identity, dates, status and priced terms of a policy issued at effectiveDate.
+// The policy expires at the end of its term, which the caller fills in; life policies mature on the same date.
+func newPolicy(id int, effectiveDate time.Time, policy Policy, terms PricedTerms) Policy {
+	expirationDate := effectiveDate.AddDate(0, terms.TermMonths, 0)
+
+	policy.ID = id
+	policy.PackageName = terms.PackageName
+	policy.Premium = terms.Premium
+	policy.Coverage = terms.Coverage
+	policy.EffectiveDate = effectiveDate.Format(time.RFC3339)
+	policy.ExpirationDate = expirationDate.Format(time.RFC3339)
+	policy.TermMonths = terms.TermMonths
+	if policy.PolicyType == LifePolicy {
+		policy.MaturityDate = policy.ExpirationDate
+		policy.LifeProduct = terms.LifeProduct
+		policy.MortalityTableID = terms.MortalityTableID
+	}
+	policy.TotalPaid = 0
+	policy.PolicyStatus = Active
+	policy.InstallmentNo = terms.InstallmentNo
+	policy.TotalPremiumToPay = terms.TotalPremiumToPay
+	policy.MaturityModel = terms.MaturityModel
+	if policy.PolicyType == HealthPolicy {
+		policy.HealthTerms = terms.HealthTerms
+	}
+
+	return policy
+}
+
+// txTime returns the transaction timestamp as a Go time.Time
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
 	if err != nil {
-		return err
+		return time.Time{}, err
 	}
 
-	// Store the policy in the ledger
-	return ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)), nil
 }
 
 // ReadPolicy returns the policy stored in the ledger with the given id
@@ -290,25 +390,16 @@ func (s *SmartContract) ReadPolicy(ctx contractapi.TransactionContextInterface,
 	return &policy, nil
 }
 
-// UpdatePolicy updates an existing policy in the ledger
-func (s *SmartContract) UpdatePolicy(ctx contractapi.TransactionContextInterface, id int, holderName string, policyType string, premium float64, coverage float64, installmentNo int, totalPremiumToPay float64) error {
-	policy, err := s.ReadPolicy(ctx, id)
-	if err != nil {
-		return err
-	}
+// putPolicy stores the policy in the ledger under its id and moves it to the next version
+func putPolicy(ctx contractapi.TransactionContextInterface, policy *Policy) error {
+	policy.Version++
 
-	policy.HolderName = holderName
-	policy.PolicyType = policyType
-	policy.Premium = premium
-	policy.Coverage = coverage
-	policy.InstallmentNo = installmentNo
-	policy.TotalPremiumToPay = totalPremiumToPay
 	policyJSON, err := json.Marshal(policy)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
+	return ctx.GetStub().PutState(strconv.Itoa(policy.ID), policyJSON)
 }
 
 // DeletePolicy removes a policy key-value pair from the ledger
@@ -316,7 +407,8 @@ func (s *SmartContract) DeletePolicy(ctx contractapi.TransactionContextInterface
 	return ctx.GetStub().DelState(strconv.Itoa(id))
 }
 
-// PayPremium allows a user to pay a specified amount towards their premium
+// PayPremium allows a user to pay a specified amount towards their premium. The amount is transferred
+// from the caller to the insurer's account in the token chaincode, and the payment is only recorded if it succeeds.
 func (s *SmartContract) PayPremium(ctx contractapi.TransactionContextInterface, id int, amount float64) error {
 	// Retrieve the policy
 	policy, err := s.ReadPolicy(ctx, id)
@@ -324,11 +416,53 @@ func (s *SmartContract) PayPremium(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
+	// Get the transaction timestamp
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := applyPremiumPayment(policy, amount, now); err != nil {
+		return err
+	}
+
+	// Move the tokens before recording anything, so a failed transfer leaves no payment behind
+	transferID, err := transferPremiumTokens(ctx, policy.CompanyName, amount)
+	if err != nil {
+		return err
+	}
+
+	// Record the premium received by the insurer and the selling agent's commission on it
+	j, err := newJournal(ctx)
+	if err != nil {
+		return err
+	}
+	if err := j.post(PremiumEntry, id, externalAccountRef(), insurerAccountRef(policy.CompanyName), amount, "Premium payment, token transfer "+transferID); err != nil {
+		return err
+	}
+	if err := s.accrueCommission(ctx, j, policy, amount); err != nil {
+		return err
+	}
+	if err := j.commit(); err != nil {
+		return err
+	}
+
+	// Store the updated policy in the ledger
+	return putPolicy(ctx, policy)
+}
+
+// applyPremiumPayment checks that a payment can be made on the policy at the given time and records it
+func applyPremiumPayment(policy *Policy, amount float64, now time.Time) error {
 	// Check if the policy is active
 	if policy.PolicyStatus != Active {
 		return fmt.Errorf("cannot pay premium on a policy that is not active")
 	}
 
+	// Premiums are no longer due once a waiver-of-premium rider has been claimed
+	if policy.PremiumsWaived {
+		return fmt.Errorf("premiums on this policy have been waived")
+	}
+
 	// Check if the policy is eligible for payment based on the time interval and maximum payment count
 	if policy.PaymentCount >= policy.InstallmentNo {
 		return fmt.Errorf("maximum number of premium payments reached")
@@ -338,10 +472,15 @@ func (s *SmartContract) PayPremium(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("payment amount must be greater than zero")
 	}
 
+	// Rider premiums are due on top of the base premium and are collected with every installment they cover
+	if riderDue := installmentDue(policy, policy.PaymentCount) - policy.Premium; amount < riderDue {
+		return fmt.Errorf("payment must cover the rider premiums of %v due with installment %d", riderDue, policy.PaymentCount+1)
+	}
+
 	// Check if the last payment time is set
 	if !policy.LastPaymentTime.IsZero() {
 		// Calculate the time elapsed since the last payment
-		elapsedTime := time.Since(policy.LastPaymentTime)
+		elapsedTime := now.Sub(policy.LastPaymentTime)
 
 		// Check if the elapsed time is less than 10 Second
 		if elapsedTime < 10*time.Second {
@@ -354,103 +493,52 @@ func (s *SmartContract) PayPremium(ctx contractapi.TransactionContextInterface,
 	policy.PaymentCount++
 
 	// Update the last payment time to the transaction timestamp
-	timestamp, err := ctx.GetStub().GetTxTimestamp()
-	if err != nil {
-		return err
-	}
-
-	// Convert the protobuf timestamp to Go time.Time
-	txTime := time.Unix(timestamp.Seconds, int64(timestamp.Nanos))
-	policy.LastPaymentTime = txTime
-
-	// Marshal the updated policy to JSON
-	policyJSON, err := json.Marshal(policy)
-	if err != nil {
-		return err
-	}
-
-	// Store the updated policy in the ledger
-	err = ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
-	if err != nil {
-		return err
-	}
+	policy.LastPaymentTime = now
 
 	return nil
 }
 
-func (s *SmartContract) ClaimCoverage(ctx contractapi.TransactionContextInterface, id int) error {
+func (s *SmartContract) Cancel(ctx contractapi.TransactionContextInterface, id int) error {
 	// Retrieve the policy
 	policy, err := s.ReadPolicy(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	// Check if the policy has already been claimed
-	if policy.PolicyStatus == Claimed {
-		return fmt.Errorf("coverage for this policy has already been claimed")
+	if policy.PolicyStatus == Cancelled {
+		return fmt.Errorf("coverage for this policy has already been Cancelled")
 	}
 
-	// Check if the total paid amount exceeds the TotalPremiumToPay
-	if policy.TotalPaid >= policy.TotalPremiumToPay {
-
-		// Transfer coverage amount to the user's balance
-		policy.UserBalance += policy.Coverage
-
-		// Update policy status to Claimed
-		policy.PolicyStatus = Claimed
+	// Only the holder and the insurer can cancel the policy
+	if err := requireHolderOrInsurer(ctx, policy, "cancel it"); err != nil {
+		return err
+	}
 
-		// Marshal the updated policy to JSON
-		policyJSON, err := json.Marshal(policy)
-		if err != nil {
-			return err
-		}
-		// Store the updated policy in the ledger
-		err = ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
-		if err != nil {
-			return err
-		}
-		return nil
+	// Life policies are surrendered for their surrender value instead of refunding TotalPaid
+	if policy.PolicyType == LifePolicy {
+		return fmt.Errorf("life policies cannot be cancelled, use SurrenderPolicy instead")
 	}
 
-	// Total paid amount is below the TotalPremiumToPay, so no action required
-	return fmt.Errorf("total paid amount is below the TotalPremiumToPay")
-}
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot cancel a policy that is not active")
+	}
 
-func (s *SmartContract) Cancel(ctx contractapi.TransactionContextInterface, id int) error {
-	// Retrieve the policy
-	policy, err := s.ReadPolicy(ctx, id)
+	// Refund the unexpired premium on the short-period scale
+	refund, err := s.recordCancellationRefund(ctx, policy)
 	if err != nil {
 		return err
 	}
 
-	if policy.PolicyStatus == Cancelled {
-		return fmt.Errorf("coverage for this policy has already been Cancelled")
+	// Transfer the refund to the customer's account
+	if err := postAndCommit(ctx, RefundEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(policy), refund.Amount, "Cancellation refund"); err != nil {
+		return err
 	}
 
-	// Check if the total paid amount is less than the TotalPremiumToPay
-	if policy.TotalPaid < policy.TotalPremiumToPay {
-
-		// Transfer TotalPaid amount to the user's balance
-		policy.UserBalance += policy.TotalPaid
+	// Update policy status to Cancelled
+	policy.PolicyStatus = Cancelled
 
-		// Update policy status to Cancelled
-		policy.PolicyStatus = Cancelled
-
-		// Marshal the updated policy to JSON
-		policyJSON, err := json.Marshal(policy)
-		if err != nil {
-			return err
-		}
-		// Store the updated policy in the ledger
-		err = ctx.GetStub().PutState(strconv.Itoa(id), policyJSON)
-		if err != nil {
-			return err
-		}
-		return nil
-	}
-
-	// Total paid amount is below the TotalPremiumToPay, so no action required
-	return fmt.Errorf("total paid amount is below the TotalPremiumToPay")
+	// Store the updated policy in the ledger
+	return putPolicy(ctx, policy)
 }
 
 // GetTotalPaid returns the total premium paid for the policy with the given id
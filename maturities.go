@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// maxMaturityBatchSize bounds how many policies one ProcessMaturities call may visit
+const maxMaturityBatchSize = 200
+
+// MaturityBatch reports the outcome of one ProcessMaturities page
+type MaturityBatch struct {
+	Matured []int `json:"Matured"`
+	Expired []int `json:"Expired"`
+	NextID  int   `json:"NextID"`
+	Done    bool  `json:"Done"`
+}
+
+// ProcessMaturities visits up to batchSize policies starting at startID and matures every active life
+// policy whose term has ended with all installments paid. Endowment-style policies are credited their
+// maturity amount and become Matured; term policies carry no maturity benefit and become Expired.
+// Call again with NextID until Done is true.
+func (s *SmartContract) ProcessMaturities(ctx contractapi.TransactionContextInterface, startID int, batchSize int) (*MaturityBatch, error) {
+	if startID < 1 {
+		startID = 1
+	}
+	if batchSize <= 0 || batchSize > maxMaturityBatchSize {
+		return nil, fmt.Errorf("batch size must be between 1 and %d", maxMaturityBatchSize)
+	}
+
+	totalPolicies, err := s.GetTotalPoliciesCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	j, err := newJournal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := MaturityBatch{Matured: []int{}, Expired: []int{}}
+
+	id := startID
+	for ; id < startID+batchSize && id <= totalPolicies; id++ {
+		policyJSON, err := ctx.GetStub().GetState(strconv.Itoa(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy %d: %v", id, err)
+		}
+		// Deleted policies leave gaps in the id sequence
+		if policyJSON == nil {
+			continue
+		}
+
+		var policy Policy
+		if err := json.Unmarshal(policyJSON, &policy); err != nil {
+			return nil, err
+		}
+
+		due, err := maturityDue(&policy, now)
+		if err != nil {
+			return nil, err
+		}
+		if !due {
+			continue
+		}
+
+		if policy.LifeProduct == TermLife {
+			policy.PolicyStatus = Expired
+			batch.Expired = append(batch.Expired, id)
+		} else {
+			amount, err := maturityAmount(&policy)
+			if err != nil {
+				return nil, fmt.Errorf("policy %d: %v", id, err)
+			}
+			if err := j.post(MaturityEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(&policy), amount, "Maturity benefit"); err != nil {
+				return nil, err
+			}
+			policy.MaturityPaid = amount
+			policy.PolicyStatus = Matured
+			batch.Matured = append(batch.Matured, id)
+		}
+
+		if err := putPolicy(ctx, &policy); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := j.commit(); err != nil {
+		return nil, err
+	}
+
+	batch.NextID = id
+	batch.Done = id > totalPolicies
+
+	return &batch, nil
+}
+
+// maturityDue reports whether a life policy has reached the end of its term with all installments paid
+func maturityDue(policy *Policy, now time.Time) (bool, error) {
+	if policy.PolicyType != LifePolicy || policy.PolicyStatus != Active {
+		return false, nil
+	}
+	if policy.PaymentCount < policy.InstallmentNo && !policy.PremiumsWaived {
+		return false, nil
+	}
+
+	expirationDate, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse expiration date of policy %d: %v", policy.ID, err)
+	}
+
+	return !now.Before(expirationDate), nil
+}
+
+// maturityAmount computes the maturity benefit from the model recorded on the policy when it was issued,
+// falling back to the recorded coverage; it never depends on settings changed after issuance
+func maturityAmount(policy *Policy) (float64, error) {
+	if policy.MaturityModel.Type != "" {
+		return policyMaturityValue(policy)
+	}
+	return policy.Coverage, nil
+}
+
+// ClaimDeathBenefit settles the death claim of an active life policy, independently of how many
+// installments were paid, by splitting the coverage across the beneficiaries. Beneficiaries named in
+// predeceased are skipped; anything not payable to a beneficiary is credited to the policyholder's account.
+// Only the insurer, having verified the death and the predeceased beneficiaries, can settle the claim.
+// When the death was accidental an active accidental death rider adds its coverage to the benefit.
+func (s *SmartContract) ClaimDeathBenefit(ctx contractapi.TransactionContextInterface, id int, predeceased []string, accidental bool) (*DeathClaimSettlement, error) {
+	if err := requireMSP(ctx, insurerMSPID, "settle death claims"); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if policy.PolicyType != LifePolicy {
+		return nil, fmt.Errorf("death claims can only be made on life policies")
+	}
+	if policy.PolicyStatus != Active {
+		return nil, fmt.Errorf("cannot claim on a policy that is not active")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := policy.Coverage
+	var riderBenefit float64
+	if accidental && activeRider(policy, AccidentalDeathRider) != nil {
+		rider, err := claimableRider(policy, AccidentalDeathRider)
+		if err != nil {
+			return nil, err
+		}
+		riderBenefit = rider.Coverage
+		amount += riderBenefit
+		endRider(policy, rider, RiderClaimed)
+	}
+
+	payouts, toEstate := splitDeathBenefit(amount, policy.Beneficiaries, predeceased)
+	settlement := DeathClaimSettlement{
+		PolicyID:     id,
+		Amount:       amount,
+		RiderBenefit: riderBenefit,
+		Payouts:      payouts,
+		PaidToEstate: toEstate,
+		SettledAt:    now.Format(time.RFC3339),
+	}
+
+	settlementKey, err := ctx.GetStub().CreateCompositeKey(deathClaimObjectType, []string{strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+
+	settlementJSON, err := json.Marshal(settlement)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.GetStub().PutState(settlementKey, settlementJSON); err != nil {
+		return nil, err
+	}
+
+	j, err := newJournal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	insurer := insurerAccountRef(policy.CompanyName)
+	for _, payout := range payouts {
+		if err := j.post(ClaimEntry, id, insurer, beneficiaryAccountRef(id, payout), payout.Amount, "Death benefit"); err != nil {
+			return nil, err
+		}
+	}
+	if err := j.post(ClaimEntry, id, insurer, customerAccountRef(policy), toEstate, "Death benefit to estate"); err != nil {
+		return nil, err
+	}
+	if err := j.commit(); err != nil {
+		return nil, err
+	}
+
+	policy.ClaimsPaid += amount
+	policy.PolicyStatus = Claimed
+
+	if err := putPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	return &settlement, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MaturityModelType selects how premiums accumulate to a maturity value
+type MaturityModelType string
+
+const (
+	SimpleInterestModel      MaturityModelType = "Simple"
+	CompoundInterestModel    MaturityModelType = "Compound"
+	RateCurveModel           MaturityModelType = "RateCurve"
+	GuaranteedPlusBonusModel MaturityModelType = "GuaranteedPlusBonus"
+)
+
+// MaturityModel describes the maturity calculation a policy was priced with so that
+// the maturity figure can be recomputed later. Rates are percentages per year and
+// each installment is treated as one annual premium.
+type MaturityModel struct {
+	Type MaturityModelType `json:"Type"`
+	// Rate is used by the Simple and Compound models
+	Rate float64 `json:"Rate"`
+	// CompoundingPerYear is 1 (annual), 4 (quarterly) or 12 (monthly) for the Compound model
+	CompoundingPerYear int `json:"CompoundingPerYear"`
+	// RateCurve holds the rate for each policy year; the last rate applies to later years
+	RateCurve []float64 `json:"RateCurve,omitempty" metadata:",optional"`
+	// GuaranteedRate compounds annually and BonusRate adds a simple bonus on each premium per year
+	GuaranteedRate float64 `json:"GuaranteedRate"`
+	BonusRate      float64 `json:"BonusRate"`
+	// Premium is the annual premium the model accumulates on a policy when it differs from the policy premium,
+	// as for life policies priced from mortality tables; zero means the policy premium
+	Premium float64 `json:"Premium"`
+}
+
+// defaultMaturityModel is the annual compounding used by CalculateMaturity
+func defaultMaturityModel(profitPercentage float64) MaturityModel {
+	if profitPercentage <= 0 {
+		profitPercentage = profitPercentageDefault
+	}
+
+	return MaturityModel{
+		Type:               CompoundInterestModel,
+		Rate:               profitPercentage,
+		CompoundingPerYear: 1,
+	}
+}
+
+func (m MaturityModel) validate() error {
+	switch m.Type {
+	case SimpleInterestModel:
+		if m.Rate < 0 {
+			return fmt.Errorf("simple interest rate must not be negative")
+		}
+	case CompoundInterestModel:
+		if m.Rate < 0 {
+			return fmt.Errorf("compound interest rate must not be negative")
+		}
+		if m.CompoundingPerYear != 1 && m.CompoundingPerYear != 4 && m.CompoundingPerYear != 12 {
+			return fmt.Errorf("compounding per year must be 1, 4 or 12")
+		}
+	case RateCurveModel:
+		if len(m.RateCurve) == 0 {
+			return fmt.Errorf("rate curve must have at least one rate")
+		}
+		for i, rate := range m.RateCurve {
+			if rate <= -100 {
+				return fmt.Errorf("rate for year %d must be greater than -100 percent", i+1)
+			}
+		}
+	case GuaranteedPlusBonusModel:
+		if m.GuaranteedRate < 0 || m.BonusRate < 0 {
+			return fmt.Errorf("guaranteed and bonus rates must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown maturity model %q", m.Type)
+	}
+
+	return nil
+}
+
+// maturityValue accumulates installmentNo annual premiums of the given amount to the end of the term
+func (m MaturityModel) maturityValue(premium float64, installmentNo int) (float64, error) {
+	if err := m.validate(); err != nil {
+		return 0, err
+	}
+
+	var maturedBalance float64
+	for k := 0; k < installmentNo; k++ {
+		maturedBalance += m.accumulate(premium, k, installmentNo)
+	}
+
+	return maturedBalance, nil
+}
+
+// accumulate returns the value at the end of the term of a premium paid at the start of year k
+func (m MaturityModel) accumulate(premium float64, k int, installmentNo int) float64 {
+	yearsRemaining := float64(installmentNo - k)
+
+	switch m.Type {
+	case SimpleInterestModel:
+		return premium * (1 + m.Rate/100*yearsRemaining)
+	case CompoundInterestModel:
+		periods := float64(m.CompoundingPerYear)
+		return premium * math.Pow(1+m.Rate/100/periods, periods*yearsRemaining)
+	case RateCurveModel:
+		value := premium
+		for year := k; year < installmentNo; year++ {
+			value *= 1 + m.curveRate(year)/100
+		}
+		return value
+	case GuaranteedPlusBonusModel:
+		guaranteed := premium * math.Pow(1+m.GuaranteedRate/100, yearsRemaining)
+		bonus := premium * m.BonusRate / 100 * yearsRemaining
+		return guaranteed + bonus
+	}
+
+	return premium
+}
+
+func (m MaturityModel) curveRate(year int) float64 {
+	if year < len(m.RateCurve) {
+		return m.RateCurve[year]
+	}
+	return m.RateCurve[len(m.RateCurve)-1]
+}
+
+// CalculateMaturityWithModel calculates the maturity value of a premium stream under the given model
+func (s *SmartContract) CalculateMaturityWithModel(ctx contractapi.TransactionContextInterface, premium float64, installmentNo int, model MaturityModel) (float64, error) {
+	return model.maturityValue(premium, installmentNo)
+}
+
+// RecalculateMaturity recomputes the maturity value of a policy from the model recorded on it
+func (s *SmartContract) RecalculateMaturity(ctx contractapi.TransactionContextInterface, id int) (float64, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if policy.MaturityModel.Type == "" {
+		return 0, fmt.Errorf("policy %d has no maturity model recorded", id)
+	}
+
+	return policyMaturityValue(policy)
+}
+
+// policyMaturityValue applies the maturity model recorded on a policy to the premium it was recorded for
+func policyMaturityValue(policy *Policy) (float64, error) {
+	premium := policy.MaturityModel.Premium
+	if premium == 0 {
+		premium = policy.Premium
+	}
+	return policy.MaturityModel.maturityValue(premium, policy.InstallmentNo)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const mortalityTableObjectType = "MortalityTable"
+
+// standardMortalityTableID is the mortality table life packages are priced from; load it with LoadMortalityTable
+const standardMortalityTableID = "Standard"
+
+// lifePackageInterestRate is the valuation interest rate, in percent per year, life packages are priced at
+const lifePackageInterestRate = 4.0
+
+// LifeProduct identifies the kind of benefit a life policy pays
+type LifeProduct string
+
+const (
+	TermLife      LifeProduct = "Term"
+	EndowmentLife LifeProduct = "Endowment"
+)
+
+// MortalityTable holds the probabilities of death within a year (qx) for one gender,
+// starting at MinAge and increasing by one year per entry
+type MortalityTable struct {
+	ID     string    `json:"ID"`
+	Gender string    `json:"Gender"`
+	MinAge int       `json:"MinAge"`
+	Qx     []float64 `json:"Qx"`
+}
+
+// LifePremium is the actuarial price of a life product for a given insured
+type LifePremium struct {
+	TableID          string      `json:"TableID"`
+	Gender           string      `json:"Gender"`
+	Age              int         `json:"Age"`
+	TermYears        int         `json:"TermYears"`
+	Product          LifeProduct `json:"Product"`
+	SumAssured       float64     `json:"SumAssured"`
+	InterestRate     float64     `json:"InterestRate"`
+	NetSinglePremium float64     `json:"NetSinglePremium"`
+	LevelPremium     float64     `json:"LevelPremium"`
+}
+
+// LoadMortalityTable stores (or replaces) the qx values of a mortality table for one gender.
+// Life premiums are priced from these tables, so only administrators can load them.
+func (s *SmartContract) LoadMortalityTable(ctx contractapi.TransactionContextInterface, tableID string, gender string, minAge int, qx []float64) error {
+	if err := requireMSP(ctx, adminMSPID, "load mortality tables"); err != nil {
+		return err
+	}
+	if tableID == "" {
+		return fmt.Errorf("table id must not be empty")
+	}
+	if gender == "" {
+		return fmt.Errorf("gender must not be empty")
+	}
+	if minAge < 0 {
+		return fmt.Errorf("minimum age must not be negative")
+	}
+	if len(qx) == 0 {
+		return fmt.Errorf("mortality table must have at least one qx value")
+	}
+	for i, q := range qx {
+		if q < 0 || q > 1 {
+			return fmt.Errorf("qx for age %d must be between 0 and 1", minAge+i)
+		}
+	}
+
+	table := MortalityTable{
+		ID:     tableID,
+		Gender: gender,
+		MinAge: minAge,
+		Qx:     qx,
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(mortalityTableObjectType, []string{tableID, gender})
+	if err != nil {
+		return err
+	}
+
+	tableJSON, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, tableJSON)
+}
+
+// ReadMortalityTable returns the mortality table stored for the given id and gender
+func (s *SmartContract) ReadMortalityTable(ctx contractapi.TransactionContextInterface, tableID string, gender string) (*MortalityTable, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(mortalityTableObjectType, []string{tableID, gender})
+	if err != nil {
+		return nil, err
+	}
+
+	tableJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mortality table %s/%s: %v", tableID, gender, err)
+	}
+	if tableJSON == nil {
+		return nil, fmt.Errorf("mortality table %s/%s does not exist", tableID, gender)
+	}
+
+	var table MortalityTable
+	err = json.Unmarshal(tableJSON, &table)
+	if err != nil {
+		return nil, err
+	}
+
+	return &table, nil
+}
+
+// CalculateLifePremium computes the net single and level annual premiums of a term or endowment
+// product from a mortality table, using the equivalence principle at the given interest rate
+func (s *SmartContract) CalculateLifePremium(ctx contractapi.TransactionContextInterface, tableID string, gender string, age int, termYears int, product string, sumAssured float64, interestRate float64) (*LifePremium, error) {
+	table, err := s.ReadMortalityTable(ctx, tableID, gender)
+	if err != nil {
+		return nil, err
+	}
+
+	return priceLifeProduct(table, age, termYears, LifeProduct(product), sumAssured, interestRate)
+}
+
+// priceLifeTerms prices a life policy from a mortality table for the insured's age and gender.
+// A package supplies the product, table, sum assured and term, and is priced at lifePackageInterestRate;
+// without a package they are taken from the arguments.
+func (s *SmartContract) priceLifeTerms(ctx contractapi.TransactionContextInterface, packageName string, gender string, age int, product string, tableID string, sumAssured float64, termYears int, interestRate float64) (PricedTerms, error) {
+	terms := PricedTerms{PackageName: packageName}
+
+	if packageName != "" {
+		packaged, err := s.priceTerms(ctx, packageName, 0, 0, 0)
+		if err != nil {
+			return terms, err
+		}
+		insurancePackage := packages[packageName]
+		if insurancePackage.LifeProduct == "" || insurancePackage.MortalityTableID == "" {
+			return terms, fmt.Errorf("package %s is not priced for life policies", packageName)
+		}
+
+		terms = packaged
+		// The package's maturity model derives the sum assured from the package premium, not the mortality premium
+		if terms.MaturityModel.Type != "" {
+			terms.MaturityModel.Premium = packaged.Premium
+		}
+		product = string(insurancePackage.LifeProduct)
+		tableID = insurancePackage.MortalityTableID
+		sumAssured = packaged.Coverage
+		termYears = packaged.InstallmentNo
+		interestRate = lifePackageInterestRate
+	}
+
+	price, err := s.CalculateLifePremium(ctx, tableID, gender, age, termYears, product, sumAssured, interestRate)
+	if err != nil {
+		return terms, err
+	}
+
+	terms.Premium = price.LevelPremium
+	terms.Coverage = sumAssured
+	terms.InstallmentNo = termYears
+	terms.TotalPremiumToPay = price.LevelPremium * float64(termYears)
+	terms.TermMonths = termYears * 12
+	terms.LifeProduct = LifeProduct(product)
+	terms.MortalityTableID = tableID
+	terms.HealthTerms = HealthTerms{}
+
+	return terms, nil
+}
+
+// priceLifeProduct applies the standard commutation-free formulas:
+// term assurance A1 = sum v^(k+1) kpx qx+k, pure endowment nEx = v^n npx,
+// and the level premium is the single premium divided by the annuity-due sum v^k kpx
+func priceLifeProduct(table *MortalityTable, age int, termYears int, product LifeProduct, sumAssured float64, interestRate float64) (*LifePremium, error) {
+	if product != TermLife && product != EndowmentLife {
+		return nil, fmt.Errorf("life product must be %s or %s", TermLife, EndowmentLife)
+	}
+	if termYears <= 0 {
+		return nil, fmt.Errorf("term must be greater than zero")
+	}
+	if sumAssured <= 0 {
+		return nil, fmt.Errorf("sum assured must be greater than zero")
+	}
+	if interestRate <= -100 {
+		return nil, fmt.Errorf("interest rate must be greater than -100 percent")
+	}
+	if age < table.MinAge || age+termYears > table.MinAge+len(table.Qx) {
+		return nil, fmt.Errorf("mortality table %s/%s does not cover ages %d to %d", table.ID, table.Gender, age, age+termYears-1)
+	}
+
+	v := 1 / (1 + interestRate/100)
+
+	var termAssurance, annuityDue float64
+	survival := 1.0 // kpx
+	for k := 0; k < termYears; k++ {
+		q := table.Qx[age-table.MinAge+k]
+		annuityDue += math.Pow(v, float64(k)) * survival
+		termAssurance += math.Pow(v, float64(k+1)) * survival * q
+		survival *= 1 - q
+	}
+
+	singlePremium := termAssurance
+	if product == EndowmentLife {
+		singlePremium += math.Pow(v, float64(termYears)) * survival
+	}
+
+	return &LifePremium{
+		TableID:          table.ID,
+		Gender:           table.Gender,
+		Age:              age,
+		TermYears:        termYears,
+		Product:          product,
+		SumAssured:       sumAssured,
+		InterestRate:     interestRate,
+		NetSinglePremium: sumAssured * singlePremium,
+		LevelPremium:     sumAssured * singlePremium / annuityDue,
+	}, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// The two-year table below prices at 5% interest with v = 1/1.05:
+// term assurance A = v 0.01 + v^2 0.99 0.02, pure endowment v^2 0.99 0.98, annuity-due 1 + v 0.99
+func TestCalculateLifePremium(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustInvoke("insurer", "LoadMortalityTable", "Test", "M", "40", "[0.01,0.02]")
+
+	tests := []struct {
+		product       LifeProduct
+		singlePremium float64
+		levelPremium  float64
+	}{
+		{TermLife, 2748.2993, 1414.5658},
+		{EndowmentLife, 90748.2993, 46708.6835},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.product), func(t *testing.T) {
+			var price LifePremium
+			n.mustInvokeJSON(&price, "holder", "CalculateLifePremium", "Test", "M", "40", "2", string(test.product), "100000", "5")
+			if math.Abs(price.NetSinglePremium-test.singlePremium) > 0.001 || math.Abs(price.LevelPremium-test.levelPremium) > 0.001 {
+				t.Errorf("premiums = %v single, %v level, want %v and %v", price.NetSinglePremium, price.LevelPremium, test.singlePremium, test.levelPremium)
+			}
+		})
+	}
+
+	n.mustFail("holder", "does not cover ages 40 to 42", "CalculateLifePremium", "Test", "M", "40", "3", string(TermLife), "100000", "5")
+}
+
+func TestLifePolicyPricedFromTable(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustInvoke("insurer", "LoadMortalityTable", "Test", "M", "40", "[0.01,0.02]")
+
+	n.mustInvoke("holder", "CreateLifeInsurancePolicy", "Bob", "40", "M", "Berlin", "Acme", "", string(TermLife), "Test", "100000", "2", "5")
+
+	policy := n.policy(n.lastPolicyID())
+	if math.Abs(policy.Premium-1414.5658) > 0.001 || policy.InstallmentNo != 2 || policy.Coverage != 100000 {
+		t.Errorf("policy premium %v over %d installments for %v, want 1414.5658 over 2 for 100000", policy.Premium, policy.InstallmentNo, policy.Coverage)
+	}
+}
+
+func TestLoadMortalityTableRequiresAdmin(t *testing.T) {
+	n := newTestNetwork(t)
+
+	n.mustFail("holder", "can load mortality tables", "LoadMortalityTable", "Test", "M", "40", "[0.01,0.02]")
+	n.mustFail("holder", "does not exist", "ReadMortalityTable", "Test", "M")
+}
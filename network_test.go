@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+
+	"insurance/token"
+	"insurance/token/tokenstub"
+)
+
+// testNetwork runs the insurance and token chaincodes on an in-memory network with an initialized ledger.
+// Transactions are submitted by name as one of these identities:
+// insurer and underwriter of the insurer's organization, holder and stranger of a customer organization
+// and bank of the bank operator.
+type testNetwork struct {
+	t          *testing.T
+	network    *tokenstub.Network
+	identities map[string][]byte
+	// tokenCompanies are the companies whose premiums the insurer receives in tokens
+	tokenCompanies map[string]bool
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	t.Helper()
+
+	insurance, err := contractapi.NewChaincode(&SmartContract{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := contractapi.NewChaincode(&token.TokenContract{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &testNetwork{
+		t:              t,
+		network:        tokenstub.NewNetwork(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)),
+		identities:     make(map[string][]byte),
+		tokenCompanies: make(map[string]bool),
+	}
+	n.network.Deploy("insurance", insurance)
+	n.network.Deploy(defaultTokenChaincodeName, tokens)
+
+	for name, mspID := range map[string]string{"insurer": insurerMSPID, "underwriter": insurerMSPID, "holder": "Org2MSP", "stranger": "Org2MSP", "bank": defaultBankOperatorMSPID} {
+		if n.identities[name], err = tokenstub.NewIdentity(mspID, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n.mustInvoke("insurer", "InitLedger")
+	return n
+}
+
+// invokeChaincode submits a transaction to the named chaincode as the named identity
+func (n *testNetwork) invokeChaincode(chaincode string, who string, args ...string) (string, error) {
+	n.t.Helper()
+	creator, ok := n.identities[who]
+	if !ok {
+		n.t.Fatalf("unknown identity %s", who)
+	}
+
+	n.network.SetCreator(creator)
+	response := n.network.Invoke(chaincode, args...)
+	if response.Status != shim.OK {
+		return "", &chaincodeError{response.Message}
+	}
+	return string(response.Payload), nil
+}
+
+// invoke submits an insurance transaction as the named identity
+func (n *testNetwork) invoke(who string, args ...string) (string, error) {
+	n.t.Helper()
+	return n.invokeChaincode("insurance", who, args...)
+}
+
+func (n *testNetwork) mustInvokeToken(who string, args ...string) string {
+	n.t.Helper()
+	payload, err := n.invokeChaincode(defaultTokenChaincodeName, who, args...)
+	if err != nil {
+		n.t.Fatalf("token %s %v: %v", who, args, err)
+	}
+	return payload
+}
+
+func (n *testNetwork) mustInvoke(who string, args ...string) string {
+	n.t.Helper()
+	payload, err := n.invoke(who, args...)
+	if err != nil {
+		n.t.Fatalf("%s %v: %v", who, args, err)
+	}
+	return payload
+}
+
+// mustFail checks that the transaction fails with an error containing want
+func (n *testNetwork) mustFail(who string, want string, args ...string) {
+	n.t.Helper()
+	_, err := n.invoke(who, args...)
+	if err == nil {
+		n.t.Fatalf("%s %v succeeded, want error %q", who, args, want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		n.t.Fatalf("%s %v error = %v, want %q", who, args, err, want)
+	}
+}
+
+// mustInvokeJSON submits the transaction and decodes its result into value
+func (n *testNetwork) mustInvokeJSON(value interface{}, who string, args ...string) {
+	n.t.Helper()
+	if err := json.Unmarshal([]byte(n.mustInvoke(who, args...)), value); err != nil {
+		n.t.Fatal(err)
+	}
+}
+
+func (n *testNetwork) policy(id int) Policy {
+	n.t.Helper()
+	var policy Policy
+	n.mustInvokeJSON(&policy, "insurer", "ReadPolicy", strconv.Itoa(id))
+	return policy
+}
+
+// healthPolicy issues a Silver health policy to the holder and returns its id
+func (n *testNetwork) healthPolicy() int {
+	n.t.Helper()
+	n.mustInvoke("holder", "CreateHealthInsurancePolicy", "Ann", "30", "Berlin", "Acme", "Silver", "0", "0", "0")
+	return n.lastPolicyID()
+}
+
+func (n *testNetwork) lastPolicyID() int {
+	n.t.Helper()
+	var policies []Policy
+	n.mustInvokeJSON(&policies, "insurer", "GetAllPolicies")
+	last := 0
+	for _, policy := range policies {
+		if policy.ID > last {
+			last = policy.ID
+		}
+	}
+	return last
+}
+
+// tokenBalance returns the token balance of the named identity
+func (n *testNetwork) tokenBalance(who string) float64 {
+	n.t.Helper()
+	balance, err := strconv.ParseFloat(n.mustInvokeToken("insurer", "BalanceOf", n.mustInvokeToken(who, "ClientAccountID")), 64)
+	if err != nil {
+		n.t.Fatal(err)
+	}
+	return balance
+}
+
+// payPremium mints the tokens for a premium, pays it as the holder and moves past the minimum payment interval
+func (n *testNetwork) payPremium(id int, amount string) {
+	n.t.Helper()
+	company := n.policy(id).CompanyName
+	if !n.tokenCompanies[company] {
+		n.mustInvoke("insurer", "RegisterInsurerTokenAccount", company)
+		n.tokenCompanies[company] = true
+	}
+
+	n.mustInvokeToken("insurer", "Mint", amount)
+	n.mustInvokeToken("insurer", "Transfer", n.mustInvokeToken("holder", "ClientAccountID"), amount)
+	n.mustInvoke("holder", "PayPremium", strconv.Itoa(id), amount)
+	n.advance(time.Minute)
+}
+
+// healthClaim submits the hospital bill described by the request JSON as the holder and has the insurer decide on it
+func (n *testNetwork) healthClaim(id int, request string) HealthClaim {
+	n.t.Helper()
+	var submitted, claim HealthClaim
+	n.mustInvokeJSON(&submitted, "holder", "SubmitHealthClaim", strconv.Itoa(id), request)
+	n.mustInvokeJSON(&claim, "insurer", "ApproveHealthClaim", strconv.Itoa(id), submitted.ID)
+	return claim
+}
+
+// advance moves the network clock forward
+func (n *testNetwork) advance(d time.Duration) {
+	n.network.Advance(d)
+}
+
+type chaincodeError struct {
+	message string
+}
+
+func (e *chaincodeError) Error() string {
+	return e.message
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// patchableFields lists the policy fields PatchPolicy may change and the statuses in which each is mutable.
+// Fields affecting price or cover are changed through their own transactions, see patchRedirects.
+// The holder's name carries no financial effect and can be corrected whatever the status, so closed
+// policies keep showing the right name on their statements.
+var patchableFields = map[string][]PolicyStatus{
+	"HolderName": {Active, Expired, Matured, Claimed, Surrendered, Cancelled, FreeLookCancelled},
+}
+
+// patchRedirects names the transaction changing fields that cannot be patched
+var patchRedirects = map[string]string{
+	"Location":          "RequestAddressChange",
+	"Coverage":          "RequestSumInsuredChange",
+	"HealthTerms":       "RequestSumInsuredChange",
+	"Premium":           "RequestInstallmentChange",
+	"InstallmentNo":     "RequestInstallmentChange",
+	"TotalPremiumToPay": "RequestInstallmentChange",
+	"Beneficiaries":     "SetBeneficiaries",
+	"AgentID":           "SetSellingAgent",
+	"AccountID":         "RequestAccountChange",
+	"Riders":            "AddRider",
+}
+
+// PatchPolicy changes some top-level fields of a policy and returns the updated policy.
+// The patch is a JSON merge patch: fields it names are set, and fields set to null are cleared.
+// A comma separated field mask restricts the change to the listed fields instead, clearing those the patch leaves out.
+// When expectedVersion is greater than 0 the patch is refused unless the policy is still at that version.
+// Only the policy holder and the insurer can patch a policy.
+func (s *SmartContract) PatchPolicy(ctx contractapi.TransactionContextInterface, id int, patch string, fieldMask string, expectedVersion int) (*Policy, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "patch it"); err != nil {
+		return nil, err
+	}
+
+	if expectedVersion > 0 && policy.Version != expectedVersion {
+		return nil, fmt.Errorf("policy %d is at version %d, expected version %d", id, policy.Version, expectedVersion)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(patch), &values); err != nil {
+		return nil, fmt.Errorf("patch must be a JSON object: %v", err)
+	}
+
+	fields := patchFields(values, fieldMask)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("patch changes no fields")
+	}
+
+	for _, field := range fields {
+		if err := checkPatchable(policy, field); err != nil {
+			return nil, err
+		}
+	}
+
+	patched, err := applyPatch(policy, values, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if patched.HolderName == "" {
+		return nil, fmt.Errorf("holder name must not be empty")
+	}
+
+	if err := putPolicy(ctx, patched); err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+// patchFields returns the fields named by the field mask, or by the patch when there is no mask
+func patchFields(values map[string]json.RawMessage, fieldMask string) []string {
+	var fields []string
+	if fieldMask != "" {
+		for _, field := range strings.Split(fieldMask, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+		return fields
+	}
+
+	for field := range values {
+		fields = append(fields, field)
+	}
+	// Map order is random; sort so every peer reports the same error
+	sort.Strings(fields)
+	return fields
+}
+
+// checkPatchable checks that the field may be patched while the policy is in its current status
+func checkPatchable(policy *Policy, field string) error {
+	statuses, ok := patchableFields[field]
+	if !ok {
+		if transaction, ok := patchRedirects[field]; ok {
+			return fmt.Errorf("field %s is changed through %s", field, transaction)
+		}
+		return fmt.Errorf("field %s cannot be patched", field)
+	}
+
+	for _, status := range statuses {
+		if policy.PolicyStatus == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s cannot be patched on a policy that is %s", field, policy.PolicyStatus)
+}
+
+// applyPatch returns a copy of the policy with the given fields taken from values, clearing those absent or null
+func applyPatch(policy *Policy, values map[string]json.RawMessage, fields []string) (*Policy, error) {
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(policyJSON, &document); err != nil {
+		return nil, err
+	}
+
+	for _, field := range fields {
+		value, ok := values[field]
+		if !ok || string(value) == "null" {
+			delete(document, field)
+			continue
+		}
+		document[field] = value
+	}
+
+	patchedJSON, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var patched Policy
+	if err := json.Unmarshal(patchedJSON, &patched); err != nil {
+		return nil, fmt.Errorf("invalid patch: %v", err)
+	}
+
+	return &patched, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPatchPolicy(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+	before := n.policy(id)
+
+	n.mustFail("stranger", "only the holder of policy", "PatchPolicy", policyID, `{"HolderName":"Eve"}`, "", "0")
+
+	var patched Policy
+	n.mustInvokeJSON(&patched, "holder", "PatchPolicy", policyID, `{"HolderName":"Anna"}`, "", strconv.Itoa(before.Version))
+	if patched.HolderName != "Anna" || patched.Premium != before.Premium || patched.Version != before.Version+1 {
+		t.Errorf("patched policy is held by %s at premium %v and version %d, want Anna at %v and version %d",
+			patched.HolderName, patched.Premium, patched.Version, before.Premium, before.Version+1)
+	}
+
+	// A second client still holding the first read loses the race instead of overwriting the change
+	n.mustFail("insurer", "expected version", "PatchPolicy", policyID, `{"HolderName":"Ann"}`, "", strconv.Itoa(before.Version))
+}
+
+func TestPatchPolicyFieldMask(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+	premium := n.policy(id).Premium
+
+	// Fields outside the mask are ignored even when the patch names them
+	var patched Policy
+	n.mustInvokeJSON(&patched, "holder", "PatchPolicy", policyID, `{"HolderName":"Anna","Premium":1}`, "HolderName", "0")
+	if patched.HolderName != "Anna" || patched.Premium != premium {
+		t.Errorf("masked patch left holder %s and premium %v, want Anna and %v", patched.HolderName, patched.Premium, premium)
+	}
+
+	// Masked fields the patch leaves out are cleared
+	n.mustFail("holder", "holder name must not be empty", "PatchPolicy", policyID, `{}`, "HolderName", "0")
+	n.mustFail("holder", "field Premium is changed through RequestInstallmentChange", "PatchPolicy", policyID, `{"Premium":1}`, "Premium", "0")
+}
+
+func TestPatchPolicyRejectsFields(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+
+	n.mustFail("holder", "field Nickname cannot be patched", "PatchPolicy", policyID, `{"Nickname":"Annie"}`, "", "0")
+	n.mustFail("holder", "field Coverage is changed through RequestSumInsuredChange", "PatchPolicy", policyID, `{"Coverage":1000000}`, "", "0")
+	n.mustFail("holder", "field AccountID is changed through RequestAccountChange", "PatchPolicy", policyID, `{"AccountID":"MINE"}`, "", "0")
+	n.mustFail("holder", "patch changes no fields", "PatchPolicy", policyID, `{}`, "", "0")
+
+	// Name corrections remain possible once the policy is closed
+	n.mustInvoke("holder", "Cancel", policyID)
+	n.mustInvoke("holder", "PatchPolicy", policyID, `{"HolderName":"Anna"}`, "", "0")
+	if policy := n.policy(id); policy.HolderName != "Anna" {
+		t.Errorf("holder name = %s, want Anna", policy.HolderName)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	payoutInstructionObjectType = "PayoutInstruction"
+	payeeBankDetailsObjectType  = "PayeeBankDetails"
+)
+
+// payeeBankDetailsCollection is the private data collection holding payee bank details, see collections_config.json
+const payeeBankDetailsCollection = "payeeBankDetails"
+
+// bankDetailsTransientKey is the transient field carrying bank details so they never reach the public ledger
+const bankDetailsTransientKey = "bankDetails"
+
+// Declare the default MSP of the organisation operating bank payouts and the setting overriding it
+const (
+	defaultBankOperatorMSPID = "BankMSP"
+	bankOperatorMSPIDSetting = "bankOperatorMSPID"
+)
+
+// PayoutStatus represents where a payout instruction is in the bank settlement flow
+type PayoutStatus string
+
+const (
+	PayoutPending    PayoutStatus = "Pending"
+	PayoutSentToBank PayoutStatus = "SentToBank"
+	PayoutSettled    PayoutStatus = "Settled"
+	PayoutFailed     PayoutStatus = "Failed"
+	// PayoutCancelled marks pending payouts the insurer withdrew before they were sent to the bank
+	PayoutCancelled PayoutStatus = "Cancelled"
+)
+
+// Journal entry types of the payout flow
+const (
+	PayoutEntry           = "Payout"
+	PayoutSettlementEntry = "PayoutSettlement"
+	PayoutReturnEntry     = "PayoutReturn"
+)
+
+// ClearingAccount is the owner type of accounts holding money between two ledger events
+const ClearingAccount = "Clearing"
+
+// BankDetails are the payee's bank account details, only stored in private data
+type BankDetails struct {
+	AccountHolder string `json:"AccountHolder"`
+	BankName      string `json:"BankName"`
+	AccountNumber string `json:"AccountNumber"`
+	RoutingCode   string `json:"RoutingCode"`
+}
+
+// PayoutInstruction asks the bank operator to pay an approved claim, refund or maturity to the payee's bank account
+type PayoutInstruction struct {
+	ID        string       `json:"ID"`
+	PolicyID  int          `json:"PolicyID"`
+	AccountID string       `json:"AccountID"`
+	EntryType string       `json:"EntryType"`
+	Amount    float64      `json:"Amount"`
+	Status    PayoutStatus `json:"Status"`
+	// BankDetailsHash is the hash of the payee bank details the payout was instructed to
+	BankDetailsHash string `json:"BankDetailsHash"`
+	BankReference   string `json:"BankReference"`
+	FailureReason   string `json:"FailureReason"`
+	CreatedAt       string `json:"CreatedAt"`
+	UpdatedAt       string `json:"UpdatedAt"`
+}
+
+// pendingPayout is a payout credited to a customer account in the current journal
+type pendingPayout struct {
+	PolicyID  int
+	Account   accountRef
+	EntryType string
+	Amount    float64
+}
+
+func payoutsInTransitRef() accountRef {
+	return accountRef{ID: "PAYOUTS-IN-TRANSIT", OwnerType: ClearingAccount, OwnerName: "Payouts in transit"}
+}
+
+// isPayoutEntry reports whether an entry type pays an approved benefit to a customer
+func isPayoutEntry(entryType string) bool {
+	switch entryType {
+	case ClaimEntry, RefundEntry, MaturityEntry, SurrenderEntry:
+		return true
+	}
+	return false
+}
+
+// SetPayeeBankDetails stores the bank details of a customer account, passed in the transient field "bankDetails".
+// Approved payouts to the account then become payout instructions for the bank operator.
+// The account owner, the bank operator and the insurer can set them.
+func (s *SmartContract) SetPayeeBankDetails(ctx contractapi.TransactionContextInterface, accountID string) error {
+	account, err := s.GetAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	if account.OwnerType != CustomerAccount {
+		return fmt.Errorf("bank details can only be set on customer accounts")
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP: %v", err)
+	}
+	bankOperator, err := bankOperatorMSPID(ctx)
+	if err != nil {
+		return err
+	}
+	if mspID != bankOperator && mspID != insurerMSPID {
+		if err := requireAccountOwner(ctx, account); err != nil {
+			return err
+		}
+	}
+
+	transient, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("failed to get transient data: %v", err)
+	}
+
+	detailsJSON, ok := transient[bankDetailsTransientKey]
+	if !ok {
+		return fmt.Errorf("bank details must be passed in the transient field %s", bankDetailsTransientKey)
+	}
+
+	var details BankDetails
+	if err := json.Unmarshal(detailsJSON, &details); err != nil {
+		return fmt.Errorf("failed to parse bank details: %v", err)
+	}
+	if details.AccountHolder == "" || details.BankName == "" || details.AccountNumber == "" {
+		return fmt.Errorf("account holder, bank name and account number are required")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(payeeBankDetailsObjectType, []string{accountID})
+	if err != nil {
+		return err
+	}
+
+	detailsJSON, err = json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(payeeBankDetailsCollection, key, detailsJSON)
+}
+
+// GetPayoutInstruction returns the public part of a payout instruction
+func (s *SmartContract) GetPayoutInstruction(ctx contractapi.TransactionContextInterface, instructionID string) (*PayoutInstruction, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(payoutInstructionObjectType, []string{instructionID})
+	if err != nil {
+		return nil, err
+	}
+
+	instructionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read payout instruction %s: %v", instructionID, err)
+	}
+	if instructionJSON == nil {
+		return nil, fmt.Errorf("payout instruction %s does not exist", instructionID)
+	}
+
+	var instruction PayoutInstruction
+	err = json.Unmarshal(instructionJSON, &instruction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instruction, nil
+}
+
+// GetPayoutBankDetails returns the payee bank details of an instruction to the bank operator,
+// provided they have not changed since the instruction was created
+func (s *SmartContract) GetPayoutBankDetails(ctx contractapi.TransactionContextInterface, instructionID string) (*BankDetails, error) {
+	if err := requireBankOperator(ctx); err != nil {
+		return nil, err
+	}
+
+	instruction, err := s.GetPayoutInstruction(ctx, instructionID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(payeeBankDetailsObjectType, []string{instruction.AccountID})
+	if err != nil {
+		return nil, err
+	}
+
+	detailsJSON, err := ctx.GetStub().GetPrivateData(payeeBankDetailsCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bank details of account %s: %v", instruction.AccountID, err)
+	}
+	if detailsJSON == nil {
+		return nil, fmt.Errorf("account %s has no bank details", instruction.AccountID)
+	}
+
+	hash := sha256.Sum256(detailsJSON)
+	if hex.EncodeToString(hash[:]) != instruction.BankDetailsHash {
+		return nil, fmt.Errorf("bank details of account %s changed after payout instruction %s was created", instruction.AccountID, instructionID)
+	}
+
+	var details BankDetails
+	err = json.Unmarshal(detailsJSON, &details)
+	if err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// MarkPayoutSent records that the bank operator has sent a pending payout to the bank
+func (s *SmartContract) MarkPayoutSent(ctx contractapi.TransactionContextInterface, instructionID string, bankReference string) error {
+	instruction, err := s.bankOperatorInstruction(ctx, instructionID, PayoutPending)
+	if err != nil {
+		return err
+	}
+	if bankReference == "" {
+		return fmt.Errorf("bank reference must not be empty")
+	}
+
+	instruction.BankReference = bankReference
+	return s.updatePayoutInstruction(ctx, instruction, PayoutSentToBank)
+}
+
+// MarkPayoutSettled records that the bank confirmed the payout, moving the money off the ledger
+func (s *SmartContract) MarkPayoutSettled(ctx contractapi.TransactionContextInterface, instructionID string) error {
+	instruction, err := s.bankOperatorInstruction(ctx, instructionID, PayoutSentToBank)
+	if err != nil {
+		return err
+	}
+
+	if err := postAndCommit(ctx, PayoutSettlementEntry, instruction.PolicyID, payoutsInTransitRef(), externalAccountRef(), instruction.Amount, "Payout settled "+instruction.BankReference); err != nil {
+		return err
+	}
+
+	return s.updatePayoutInstruction(ctx, instruction, PayoutSettled)
+}
+
+// MarkPayoutFailed records that the bank rejected the payout and returns the money to the customer account
+func (s *SmartContract) MarkPayoutFailed(ctx contractapi.TransactionContextInterface, instructionID string, reason string) error {
+	instruction, err := s.bankOperatorInstruction(ctx, instructionID, PayoutSentToBank)
+	if err != nil {
+		return err
+	}
+
+	return s.returnPayout(ctx, instruction, PayoutFailed, "Payout failed: ", reason)
+}
+
+// CancelPayout withdraws a payout that has not been sent to the bank yet, for example when the payee's bank
+// details turn out to be wrong, and returns the money to the customer account. Only the insurer can cancel payouts.
+func (s *SmartContract) CancelPayout(ctx contractapi.TransactionContextInterface, instructionID string, reason string) error {
+	if err := requireMSP(ctx, insurerMSPID, "cancel payouts"); err != nil {
+		return err
+	}
+	if reason == "" {
+		return fmt.Errorf("a reason is required to cancel a payout")
+	}
+
+	instruction, err := s.GetPayoutInstruction(ctx, instructionID)
+	if err != nil {
+		return err
+	}
+	if instruction.Status != PayoutPending {
+		return fmt.Errorf("payout instruction %s is %s, only %s payouts can be cancelled", instructionID, instruction.Status, PayoutPending)
+	}
+
+	return s.returnPayout(ctx, instruction, PayoutCancelled, "Payout cancelled: ", reason)
+}
+
+// GetBankOperatorMSPID returns the MSP of the organisation operating bank payouts
+func (s *SmartContract) GetBankOperatorMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return bankOperatorMSPID(ctx)
+}
+
+// UpdateBankOperatorMSPID updates the MSP of the organisation operating bank payouts; only administrators can change it.
+// The new MSP must also be a member of the payeeBankDetails collection, see collections_config.json.
+func (s *SmartContract) UpdateBankOperatorMSPID(ctx contractapi.TransactionContextInterface, mspID string) error {
+	if mspID == "" {
+		return fmt.Errorf("MSP id must not be empty")
+	}
+	return putSetting(ctx, bankOperatorMSPIDSetting, mspID)
+}
+
+func bankOperatorMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID := defaultBankOperatorMSPID
+	if err := readSetting(ctx, bankOperatorMSPIDSetting, &mspID); err != nil {
+		return "", err
+	}
+	return mspID, nil
+}
+
+// returnPayout moves the money of a payout out of transit back to the customer account and records why
+func (s *SmartContract) returnPayout(ctx contractapi.TransactionContextInterface, instruction *PayoutInstruction, status PayoutStatus, description string, reason string) error {
+	account, err := s.GetAccount(ctx, instruction.AccountID)
+	if err != nil {
+		return err
+	}
+
+	to := accountRef{ID: account.ID, OwnerType: account.OwnerType, OwnerName: account.OwnerName}
+	if err := postAndCommit(ctx, PayoutReturnEntry, instruction.PolicyID, payoutsInTransitRef(), to, instruction.Amount, description+reason); err != nil {
+		return err
+	}
+
+	instruction.FailureReason = reason
+	return s.updatePayoutInstruction(ctx, instruction, status)
+}
+
+// createPayoutInstructions turns the payouts of a journal into instructions for every account with bank details,
+// moving the money from the customer account into transit. Accounts without bank details keep the money.
+// Only the hash of the bank details is read, which every peer holds, so payouts can be endorsed by peers
+// and requested by clients outside the bank details collection.
+func (j *journal) createPayoutInstructions() error {
+	payouts := j.payouts
+	j.payouts = nil
+
+	for i, payout := range payouts {
+		detailsKey, err := j.ctx.GetStub().CreateCompositeKey(payeeBankDetailsObjectType, []string{payout.Account.ID})
+		if err != nil {
+			return err
+		}
+
+		detailsHash, err := j.ctx.GetStub().GetPrivateDataHash(payeeBankDetailsCollection, detailsKey)
+		if err != nil {
+			return fmt.Errorf("failed to read bank details hash of account %s: %v", payout.Account.ID, err)
+		}
+		if detailsHash == nil {
+			continue
+		}
+
+		if err := j.post(PayoutEntry, payout.PolicyID, payout.Account, payoutsInTransitRef(), payout.Amount, "Payout instruction"); err != nil {
+			return err
+		}
+
+		instruction := PayoutInstruction{
+			ID:              fmt.Sprintf("%s-P%03d", j.ctx.GetStub().GetTxID(), i),
+			PolicyID:        payout.PolicyID,
+			AccountID:       payout.Account.ID,
+			EntryType:       payout.EntryType,
+			Amount:          payout.Amount,
+			Status:          PayoutPending,
+			BankDetailsHash: hex.EncodeToString(detailsHash),
+			CreatedAt:       j.now.Format(time.RFC3339),
+			UpdatedAt:       j.now.Format(time.RFC3339),
+		}
+
+		key, err := j.ctx.GetStub().CreateCompositeKey(payoutInstructionObjectType, []string{instruction.ID})
+		if err != nil {
+			return err
+		}
+
+		instructionJSON, err := json.Marshal(instruction)
+		if err != nil {
+			return err
+		}
+
+		if err := j.ctx.GetStub().PutState(key, instructionJSON); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bankOperatorInstruction checks the caller belongs to the bank operator and the instruction has the expected status
+func (s *SmartContract) bankOperatorInstruction(ctx contractapi.TransactionContextInterface, instructionID string, expected PayoutStatus) (*PayoutInstruction, error) {
+	if err := requireBankOperator(ctx); err != nil {
+		return nil, err
+	}
+
+	instruction, err := s.GetPayoutInstruction(ctx, instructionID)
+	if err != nil {
+		return nil, err
+	}
+	if instruction.Status != expected {
+		return nil, fmt.Errorf("payout instruction %s is %s, expected %s", instructionID, instruction.Status, expected)
+	}
+
+	return instruction, nil
+}
+
+func (s *SmartContract) updatePayoutInstruction(ctx contractapi.TransactionContextInterface, instruction *PayoutInstruction, status PayoutStatus) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	instruction.Status = status
+	instruction.UpdatedAt = now.Format(time.RFC3339)
+
+	key, err := ctx.GetStub().CreateCompositeKey(payoutInstructionObjectType, []string{instruction.ID})
+	if err != nil {
+		return err
+	}
+
+	instructionJSON, err := json.Marshal(instruction)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, instructionJSON)
+}
+
+func requireBankOperator(ctx contractapi.TransactionContextInterface) error {
+	bankOperator, err := bankOperatorMSPID(ctx)
+	if err != nil {
+		return err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP: %v", err)
+	}
+	if mspID != bankOperator {
+		return fmt.Errorf("only the bank operator %s can change payout instructions", bankOperator)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// payoutNetwork pays a first claim into the holder's customer account, records the holder's bank details
+// and approves a second claim of 8000, which becomes a pending payout instruction. It returns the customer
+// account and the instruction id.
+func payoutNetwork(t *testing.T) (*testNetwork, string, string) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	n.payPremium(id, "11112")
+	n.payPremium(id, "11112")
+	n.advance(31 * 24 * time.Hour)
+
+	n.healthClaim(id, `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":15000}`)
+
+	policy := n.policy(id)
+	accountID := customerAccountRef(&policy).ID
+	n.network.SetTransient(map[string][]byte{bankDetailsTransientKey: []byte(`{"AccountHolder":"Ann","BankName":"Bank","AccountNumber":"DE00123","RoutingCode":"X"}`)})
+	n.mustInvoke("holder", "SetPayeeBankDetails", accountID)
+	n.network.SetTransient(nil)
+
+	// The deductible is used up, so 10000 less the co-pay is paid
+	n.healthClaim(id, `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":10000}`)
+
+	var statement AccountStatement
+	n.mustInvokeJSON(&statement, "holder", "GetAccountStatement", accountID, "", "")
+	last := statement.Lines[len(statement.Lines)-1].Entry
+	if last.Type != PayoutEntry {
+		t.Fatalf("last entry of account %s is %s, want %s", accountID, last.Type, PayoutEntry)
+	}
+	instructionID := last.ID[:strings.LastIndex(last.ID, "-")] + "-P000"
+
+	return n, accountID, instructionID
+}
+
+func accountBalance(n *testNetwork, accountID string) float64 {
+	n.t.Helper()
+	var account Account
+	n.mustInvokeJSON(&account, "holder", "GetAccount", accountID)
+	return account.Balance
+}
+
+func TestCancelPayout(t *testing.T) {
+	n, accountID, instructionID := payoutNetwork(t)
+	if balance := accountBalance(n, accountID); balance != 8000 {
+		t.Fatalf("balance with the payout in transit = %v, want 8000", balance)
+	}
+
+	n.mustFail("holder", "only members of Org1MSP can cancel payouts", "CancelPayout", instructionID, "wrong account")
+	n.mustFail("insurer", "a reason is required", "CancelPayout", instructionID, "")
+	n.mustInvoke("insurer", "CancelPayout", instructionID, "wrong account")
+
+	var instruction PayoutInstruction
+	n.mustInvokeJSON(&instruction, "holder", "GetPayoutInstruction", instructionID)
+	if instruction.Status != PayoutCancelled || instruction.FailureReason != "wrong account" {
+		t.Errorf("instruction is %s because of %q, want it cancelled", instruction.Status, instruction.FailureReason)
+	}
+	if balance := accountBalance(n, accountID); balance != 16000 {
+		t.Errorf("balance after the cancellation = %v, want the 8000 returned", balance)
+	}
+
+	n.mustFail("insurer", "only Pending payouts can be cancelled", "CancelPayout", instructionID, "again")
+	n.mustFail("bank", "expected Pending", "MarkPayoutSent", instructionID, "REF1")
+}
+
+func TestBankOperatorSetting(t *testing.T) {
+	n, _, instructionID := payoutNetwork(t)
+
+	n.mustFail("holder", "can change contract settings", "UpdateBankOperatorMSPID", "Org2MSP")
+	n.mustInvoke("insurer", "UpdateBankOperatorMSPID", "Org2MSP")
+	if mspID := n.mustInvoke("holder", "GetBankOperatorMSPID"); mspID != "Org2MSP" {
+		t.Errorf("bank operator = %s, want Org2MSP", mspID)
+	}
+
+	n.mustFail("bank", "only the bank operator Org2MSP", "MarkPayoutSent", instructionID, "REF1")
+	n.mustInvoke("stranger", "MarkPayoutSent", instructionID, "REF1")
+	n.mustFail("insurer", "only Pending payouts can be cancelled", "CancelPayout", instructionID, "too late")
+}
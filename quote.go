@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const quoteObjectType = "Quote"
+
+// Declare the default number of hours a quote can be bound after it was priced and the setting overriding it
+const (
+	defaultQuoteValidityHours = 24
+	quoteValidityHoursSetting = "quoteValidityHours"
+)
+
+// Quote holds the exact priced terms offered to a customer before a policy is issued
+type Quote struct {
+	ID          string      `json:"ID"`
+	HolderName  string      `json:"HolderName"`
+	Age         int         `json:"Age"`
+	Gender      string      `json:"Gender"`
+	Location    string      `json:"Location"`
+	CompanyName string      `json:"CompanyName"`
+	PolicyType  string      `json:"PolicyType"`
+	Terms       PricedTerms `json:"Terms"`
+	CreatedBy   string      `json:"CreatedBy"`
+	CreatedAt   string      `json:"CreatedAt"`
+	ExpiresAt   string      `json:"ExpiresAt"`
+	Bound       bool        `json:"Bound"`
+	PolicyID    int         `json:"PolicyID"`
+}
+
+// CreateQuote prices a health policy and stores the quote so it can later be bound without repricing.
+// Life quotes are priced from mortality tables by CreateLifeQuote.
+// When evaluated instead of submitted it simply returns the priced quote.
+func (s *SmartContract) CreateQuote(ctx contractapi.TransactionContextInterface, policyType string, holderName string, age int, location string, companyName string, packageName string, premium float64, installmentNo int, profitPercentage float64) (*Quote, error) {
+	if policyType == LifePolicy {
+		return nil, fmt.Errorf("life quotes are priced from mortality tables, use CreateLifeQuote")
+	}
+	if policyType != HealthPolicy {
+		return nil, fmt.Errorf("policy type must be %s or %s", HealthPolicy, LifePolicy)
+	}
+
+	terms, err := s.priceTerms(ctx, packageName, premium, installmentNo, profitPercentage)
+	if err != nil {
+		return nil, err
+	}
+	terms.TermMonths, err = policyTermMonths(ctx, policyType, packageName, terms.InstallmentNo)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storeQuote(ctx, Quote{
+		HolderName:  holderName,
+		Age:         age,
+		Location:    location,
+		CompanyName: companyName,
+		PolicyType:  policyType,
+		Terms:       terms,
+	})
+}
+
+// CreateLifeQuote prices a life policy from a mortality table for the insured's age and gender and stores the quote.
+// A package supplies the product, table, sum assured and term.
+func (s *SmartContract) CreateLifeQuote(ctx contractapi.TransactionContextInterface, holderName string, age int, gender string, location string, companyName string, packageName string, product string, tableID string, sumAssured float64, termYears int, interestRate float64) (*Quote, error) {
+	terms, err := s.priceLifeTerms(ctx, packageName, gender, age, product, tableID, sumAssured, termYears, interestRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.storeQuote(ctx, Quote{
+		HolderName:  holderName,
+		Age:         age,
+		Gender:      gender,
+		Location:    location,
+		CompanyName: companyName,
+		PolicyType:  LifePolicy,
+		Terms:       terms,
+	})
+}
+
+// storeQuote gives the quote its id, requester and validity and stores it
+func (s *SmartContract) storeQuote(ctx contractapi.TransactionContextInterface, quote Quote) (*Quote, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hours, err := quoteValidityHours(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	quote.CreatedBy, err = ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity: %v", err)
+	}
+
+	quote.ID = ctx.GetStub().GetTxID()
+	quote.CreatedAt = now.Format(time.RFC3339)
+	quote.ExpiresAt = now.Add(time.Duration(hours) * time.Hour).Format(time.RFC3339)
+
+	if err := s.putQuote(ctx, &quote); err != nil {
+		return nil, err
+	}
+
+	return &quote, nil
+}
+
+// ReadQuote returns the quote stored in the ledger with the given id
+func (s *SmartContract) ReadQuote(ctx contractapi.TransactionContextInterface, quoteID string) (*Quote, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(quoteObjectType, []string{quoteID})
+	if err != nil {
+		return nil, err
+	}
+
+	quoteJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quote %s: %v", quoteID, err)
+	}
+	if quoteJSON == nil {
+		return nil, fmt.Errorf("quote %s does not exist", quoteID)
+	}
+
+	var quote Quote
+	err = json.Unmarshal(quoteJSON, &quote)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quote, nil
+}
+
+// BindQuote issues a policy from an unexpired quote using the quoted terms and returns the new policy id.
+// Only the identity that requested the quote can bind it, and it becomes the policy holder.
+func (s *SmartContract) BindQuote(ctx contractapi.TransactionContextInterface, quoteID string) (int, error) {
+	quote, err := s.ReadQuote(ctx, quoteID)
+	if err != nil {
+		return 0, err
+	}
+
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if caller != quote.CreatedBy {
+		return 0, fmt.Errorf("quote %s can only be bound by the identity that requested it", quoteID)
+	}
+
+	if quote.Bound {
+		return 0, fmt.Errorf("quote %s has already been bound to policy %d", quoteID, quote.PolicyID)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, quote.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse quote expiry: %v", err)
+	}
+	if now.After(expiresAt) {
+		return 0, fmt.Errorf("quote %s expired at %s", quoteID, quote.ExpiresAt)
+	}
+
+	id, err := s.issuePolicy(ctx, Policy{
+		HolderName:  quote.HolderName,
+		Age:         quote.Age,
+		Gender:      quote.Gender,
+		Location:    quote.Location,
+		CompanyName: quote.CompanyName,
+		PolicyType:  quote.PolicyType,
+	}, quote.Terms)
+	if err != nil {
+		return 0, err
+	}
+
+	quote.Bound = true
+	quote.PolicyID = id
+	if err := s.putQuote(ctx, quote); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// GetQuoteValidityHours returns how many hours a quote can be bound after it was priced
+func (s *SmartContract) GetQuoteValidityHours(ctx contractapi.TransactionContextInterface) (int, error) {
+	return quoteValidityHours(ctx)
+}
+
+// UpdateQuoteValidityHours updates how many hours later quotes can be bound; only administrators can change it
+func (s *SmartContract) UpdateQuoteValidityHours(ctx contractapi.TransactionContextInterface, hours int) error {
+	if hours <= 0 {
+		return fmt.Errorf("quote validity must be greater than 0 hours")
+	}
+	return putSetting(ctx, quoteValidityHoursSetting, hours)
+}
+
+func quoteValidityHours(ctx contractapi.TransactionContextInterface) (int, error) {
+	hours := defaultQuoteValidityHours
+	if err := readSetting(ctx, quoteValidityHoursSetting, &hours); err != nil {
+		return 0, err
+	}
+	return hours, nil
+}
+
+func (s *SmartContract) putQuote(ctx contractapi.TransactionContextInterface, quote *Quote) error {
+	key, err := ctx.GetStub().CreateCompositeKey(quoteObjectType, []string{quote.ID})
+	if err != nil {
+		return err
+	}
+
+	quoteJSON, err := json.Marshal(quote)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, quoteJSON)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBindQuote(t *testing.T) {
+	n := newTestNetwork(t)
+
+	var quote Quote
+	n.mustInvokeJSON(&quote, "holder", "CreateQuote", HealthPolicy, "Ann", "30", "Berlin", "Acme", "Silver", "0", "0", "0")
+
+	n.mustFail("stranger", "can only be bound by the identity that requested it", "BindQuote", quote.ID)
+
+	id, err := strconv.Atoi(n.mustInvoke("holder", "BindQuote", quote.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := n.policy(id)
+	if policy.HolderID != quote.CreatedBy {
+		t.Errorf("policy holder = %s, want the quote requester %s", policy.HolderID, quote.CreatedBy)
+	}
+	if policy.Premium != quote.Terms.Premium || policy.Coverage != quote.Terms.Coverage {
+		t.Errorf("policy premium %v and coverage %v differ from the quoted %v and %v", policy.Premium, policy.Coverage, quote.Terms.Premium, quote.Terms.Coverage)
+	}
+
+	n.mustFail("holder", "has already been bound", "BindQuote", quote.ID)
+}
+
+func TestQuoteValidity(t *testing.T) {
+	n := newTestNetwork(t)
+
+	var quote Quote
+	n.mustInvokeJSON(&quote, "holder", "CreateQuote", HealthPolicy, "Ann", "30", "Berlin", "Acme", "Silver", "0", "0", "0")
+	n.advance(25 * time.Hour)
+	n.mustFail("holder", "expired", "BindQuote", quote.ID)
+
+	n.mustFail("holder", "can change contract settings", "UpdateQuoteValidityHours", "48")
+	n.mustInvoke("insurer", "UpdateQuoteValidityHours", "48")
+
+	n.mustInvokeJSON(&quote, "holder", "CreateQuote", HealthPolicy, "Ann", "30", "Berlin", "Acme", "Silver", "0", "0", "0")
+	n.advance(25 * time.Hour)
+	n.mustInvoke("holder", "BindQuote", quote.ID)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const refundObjectType = "Refund"
+
+// Declare the default fee charged when a health policy is cancelled and the setting overriding it
+const (
+	defaultCancellationFee = 250.0
+	cancellationFeeSetting = "cancellationFee"
+)
+
+// shortPeriodRate is the percentage of premium retained when a policy is cancelled
+// before the given fraction of its term has elapsed
+type shortPeriodRate struct {
+	ElapsedUpTo     float64
+	RetainedPercent float64
+}
+
+// shortPeriodScale must be ordered by ElapsedUpTo and end at the full term
+var shortPeriodScale = []shortPeriodRate{
+	{ElapsedUpTo: 1.0 / 12, RetainedPercent: 20},
+	{ElapsedUpTo: 3.0 / 12, RetainedPercent: 40},
+	{ElapsedUpTo: 6.0 / 12, RetainedPercent: 60},
+	{ElapsedUpTo: 9.0 / 12, RetainedPercent: 80},
+	{ElapsedUpTo: 1, RetainedPercent: 100},
+}
+
+// Refund records how the amount returned to a policyholder was calculated
+type Refund struct {
+	ID              string  `json:"ID"`
+	PolicyID        int     `json:"PolicyID"`
+	Reason          string  `json:"Reason"`
+	PremiumPaid     float64 `json:"PremiumPaid"`
+	ElapsedFraction float64 `json:"ElapsedFraction"`
+	RetainedPercent float64 `json:"RetainedPercent"`
+	RetainedPremium float64 `json:"RetainedPremium"`
+	CancellationFee float64 `json:"CancellationFee"`
+	ClaimsPaid      float64 `json:"ClaimsPaid"`
+	Amount          float64 `json:"Amount"`
+	CreatedAt       string  `json:"CreatedAt"`
+}
+
+// GetPolicyRefunds returns all refunds recorded for the policy with the given id
+func (s *SmartContract) GetPolicyRefunds(ctx contractapi.TransactionContextInterface, id int) ([]Refund, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(refundObjectType, []string{strconv.Itoa(id)})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	refunds := []Refund{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var refund Refund
+		err = json.Unmarshal(queryResponse.Value, &refund)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+
+	return refunds, nil
+}
+
+// recordCancellationRefund calculates the short-period refund of a cancelled policy and stores it as a Refund asset.
+// The premium for the elapsed part of the term is retained, then the cancellation fee and claims already paid are deducted.
+func (s *SmartContract) recordCancellationRefund(ctx contractapi.TransactionContextInterface, policy *Policy) (*Refund, error) {
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	elapsed, err := elapsedTermFraction(policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := cancellationFee(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	refund := Refund{
+		ID:              ctx.GetStub().GetTxID(),
+		PolicyID:        policy.ID,
+		Reason:          "Cancellation",
+		PremiumPaid:     policy.TotalPaid,
+		ElapsedFraction: elapsed,
+		RetainedPercent: shortPeriodRetainedPercent(elapsed),
+		CancellationFee: fee,
+		ClaimsPaid:      policy.ClaimsPaid,
+		CreatedAt:       now.Format(time.RFC3339),
+	}
+	refund.RetainedPremium = refund.PremiumPaid * refund.RetainedPercent / 100
+	refund.Amount = refund.PremiumPaid - refund.RetainedPremium - refund.CancellationFee - refund.ClaimsPaid
+	if refund.Amount < 0 {
+		refund.Amount = 0
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(refundObjectType, []string{strconv.Itoa(policy.ID), refund.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	refundJSON, err := json.Marshal(refund)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ctx.GetStub().PutState(key, refundJSON); err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// GetCancellationFee returns the fee charged when a health policy is cancelled
+func (s *SmartContract) GetCancellationFee(ctx contractapi.TransactionContextInterface) (float64, error) {
+	return cancellationFee(ctx)
+}
+
+// UpdateCancellationFee updates the fee charged on later cancellations; only administrators can change it
+func (s *SmartContract) UpdateCancellationFee(ctx contractapi.TransactionContextInterface, fee float64) error {
+	if fee < 0 {
+		return fmt.Errorf("cancellation fee must not be negative")
+	}
+	return putSetting(ctx, cancellationFeeSetting, fee)
+}
+
+func cancellationFee(ctx contractapi.TransactionContextInterface) (float64, error) {
+	fee := defaultCancellationFee
+	if err := readSetting(ctx, cancellationFeeSetting, &fee); err != nil {
+		return 0, err
+	}
+	return fee, nil
+}
+
+// elapsedTermFraction returns how much of the policy term has passed at the given time, between 0 and 1
+func elapsedTermFraction(policy *Policy, now time.Time) (float64, error) {
+	effectiveDate, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse effective date: %v", err)
+	}
+
+	expirationDate, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse expiration date: %v", err)
+	}
+
+	term := expirationDate.Sub(effectiveDate)
+	if term <= 0 {
+		return 1, nil
+	}
+
+	elapsed := float64(now.Sub(effectiveDate)) / float64(term)
+	if elapsed < 0 {
+		return 0, nil
+	}
+	if elapsed > 1 {
+		return 1, nil
+	}
+
+	return elapsed, nil
+}
+
+func shortPeriodRetainedPercent(elapsed float64) float64 {
+	for _, rate := range shortPeriodScale {
+		if elapsed <= rate.ElapsedUpTo {
+			return rate.RetainedPercent
+		}
+	}
+	return 100
+}
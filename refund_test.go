@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestCancelRefund(t *testing.T) {
+	tests := []struct {
+		name string
+		fee  string
+		want float64
+	}{
+		// Cancelled in the first month: 20% of the premium is retained before the fee
+		{"default fee", "", 11112*0.8 - 250},
+		{"updated fee", "100", 11112*0.8 - 100},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			if test.fee != "" {
+				n.mustFail("holder", "can change contract settings", "UpdateCancellationFee", test.fee)
+				n.mustInvoke("insurer", "UpdateCancellationFee", test.fee)
+			}
+
+			id := n.healthPolicy()
+			n.payPremium(id, "11112")
+
+			n.mustFail("stranger", "only the holder of policy", "Cancel", strconv.Itoa(id))
+			n.mustInvoke("holder", "Cancel", strconv.Itoa(id))
+
+			var refunds []Refund
+			n.mustInvokeJSON(&refunds, "holder", "GetPolicyRefunds", strconv.Itoa(id))
+			if len(refunds) != 1 || math.Abs(refunds[0].Amount-test.want) > 1e-9 {
+				t.Errorf("refunds = %+v, want one of %v", refunds, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// No-claims bonus types
+const (
+	SumInsuredBonus      = "SumInsured"
+	PremiumDiscountBonus = "PremiumDiscount"
+)
+
+// Declare the default renewal window around the expiration date and the setting overriding it
+var defaultRenewalWindow = RenewalWindow{DaysBefore: 30, GraceDays: 30}
+
+const renewalWindowSetting = "renewalWindow"
+
+// Declare the default no-claims bonus earned for each claim-free term and its maximum, and the setting overriding it
+var defaultNoClaimsBonusConfig = NoClaimsBonusConfig{Type: SumInsuredBonus, StepPercent: 10, MaxPercent: 50}
+
+const noClaimsBonusSetting = "noClaimsBonus"
+
+// NoClaimsBonusConfig configures the bonus given on renewal of a term without paid claims
+type NoClaimsBonusConfig struct {
+	Type        string  `json:"Type"`
+	StepPercent float64 `json:"StepPercent"`
+	MaxPercent  float64 `json:"MaxPercent"`
+}
+
+// NoClaimsBonus is the bonus applied to a term: SumInsured raises the sum insured by Percent,
+// PremiumDiscount lowers the premium by Percent
+type NoClaimsBonus struct {
+	Type    string  `json:"Type"`
+	Percent float64 `json:"Percent"`
+}
+
+// RenewalWindow holds the renewal window around the expiration date in days
+type RenewalWindow struct {
+	DaysBefore int `json:"DaysBefore"`
+	GraceDays  int `json:"GraceDays"`
+}
+
+// RenewPolicy issues the next term of a health policy within its renewal window and returns the new policy id.
+// The new term starts when the current one expires, keeps the waiting-period credit of the continuous cover
+// and earns a no-claims bonus when no claim was paid in the current term and its premiums were paid as they fell due.
+// The new term cannot be claimed on before it starts. Only the policy holder and the insurer can renew a policy.
+func (s *SmartContract) RenewPolicy(ctx contractapi.TransactionContextInterface, id int) (int, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "renew it"); err != nil {
+		return 0, err
+	}
+
+	if policy.PolicyType != HealthPolicy {
+		return 0, fmt.Errorf("only health policies can be renewed")
+	}
+	if policy.PolicyStatus != Active && policy.PolicyStatus != Expired {
+		return 0, fmt.Errorf("cannot renew a policy that is %s", policy.PolicyStatus)
+	}
+	if policy.RenewedBy != 0 {
+		return 0, fmt.Errorf("policy %d was already renewed by policy %d", id, policy.RenewedBy)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	expiry, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse expiration date: %v", err)
+	}
+
+	window, err := renewalWindow(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	windowOpens := expiry.AddDate(0, 0, -window.DaysBefore)
+	graceEnds := expiry.AddDate(0, 0, window.GraceDays)
+	if now.Before(windowOpens) {
+		return 0, fmt.Errorf("renewal window opens on %s", windowOpens.Format(time.RFC3339))
+	}
+	if now.After(graceEnds) {
+		return 0, fmt.Errorf("renewal grace period ended on %s, a new policy must be issued", graceEnds.Format(time.RFC3339))
+	}
+
+	// Cover continues from the expiration date; a term renewed in the grace period starts when it is renewed
+	effectiveDate := expiry
+	if now.After(expiry) {
+		effectiveDate = now
+	}
+
+	since, err := coverStart(policy)
+	if err != nil {
+		return 0, err
+	}
+
+	newID, err := s.getNextID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	config, err := noClaimsBonusConfig(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	due, err := installmentsDueBy(policy, now)
+	if err != nil {
+		return 0, err
+	}
+	paidUp := policy.PremiumsWaived || policy.PaymentCount >= due
+
+	bonus := renewalBonus(policy, config, paidUp)
+	terms := renewalTerms(policy, bonus)
+	if err := fillTermMonths(ctx, policy.PolicyType, &terms); err != nil {
+		return 0, err
+	}
+
+	renewal := newPolicy(newID, effectiveDate, Policy{
+		HolderName:            policy.HolderName,
+		Age:                   policy.Age,
+		Location:              policy.Location,
+		CompanyName:           policy.CompanyName,
+		PolicyType:            policy.PolicyType,
+		Gender:                policy.Gender,
+		PreExistingConditions: policy.PreExistingConditions,
+		Members:               policy.Members,
+		HolderID:              policy.HolderID,
+		AccountID:             policy.AccountID,
+		AgentID:               policy.AgentID,
+		RenewalOf:             policy.ID,
+		ContinuousCoverSince:  since.Format(time.RFC3339),
+		NoClaimsBonus:         bonus,
+	}, terms)
+	rebaseFloaterPremium(&renewal)
+
+	policy.RenewedBy = newID
+
+	if err := putPolicy(ctx, policy); err != nil {
+		return 0, err
+	}
+	if err := putPolicy(ctx, &renewal); err != nil {
+		return 0, err
+	}
+
+	return newID, nil
+}
+
+// GetNoClaimsBonusConfig returns the current no-claims bonus configuration
+func (s *SmartContract) GetNoClaimsBonusConfig(ctx contractapi.TransactionContextInterface) (NoClaimsBonusConfig, error) {
+	return noClaimsBonusConfig(ctx)
+}
+
+// UpdateNoClaimsBonusConfig updates the no-claims bonus applied on later renewals; only administrators can change it
+func (s *SmartContract) UpdateNoClaimsBonusConfig(ctx contractapi.TransactionContextInterface, bonusType string, stepPercent float64, maxPercent float64) error {
+	if bonusType != SumInsuredBonus && bonusType != PremiumDiscountBonus {
+		return fmt.Errorf("bonus type must be %s or %s", SumInsuredBonus, PremiumDiscountBonus)
+	}
+	if stepPercent < 0 || maxPercent < stepPercent {
+		return fmt.Errorf("step must not be negative and must not exceed the maximum")
+	}
+	// A full discount would make the base premium impossible to recover on the next renewal
+	if bonusType == PremiumDiscountBonus && maxPercent >= 100 {
+		return fmt.Errorf("premium discount must be less than 100 percent")
+	}
+
+	return putSetting(ctx, noClaimsBonusSetting, NoClaimsBonusConfig{Type: bonusType, StepPercent: stepPercent, MaxPercent: maxPercent})
+}
+
+// GetRenewalWindow returns how many days before and after expiry a policy can be renewed
+func (s *SmartContract) GetRenewalWindow(ctx contractapi.TransactionContextInterface) (RenewalWindow, error) {
+	return renewalWindow(ctx)
+}
+
+// UpdateRenewalWindow updates how many days before and after expiry a policy can be renewed; only administrators can change it
+func (s *SmartContract) UpdateRenewalWindow(ctx contractapi.TransactionContextInterface, daysBefore int, graceDays int) error {
+	if daysBefore < 0 || graceDays < 0 {
+		return fmt.Errorf("renewal window days must not be negative")
+	}
+	return putSetting(ctx, renewalWindowSetting, RenewalWindow{DaysBefore: daysBefore, GraceDays: graceDays})
+}
+
+func noClaimsBonusConfig(ctx contractapi.TransactionContextInterface) (NoClaimsBonusConfig, error) {
+	config := defaultNoClaimsBonusConfig
+	if err := readSetting(ctx, noClaimsBonusSetting, &config); err != nil {
+		return NoClaimsBonusConfig{}, err
+	}
+	return config, nil
+}
+
+func renewalWindow(ctx contractapi.TransactionContextInterface) (RenewalWindow, error) {
+	window := defaultRenewalWindow
+	if err := readSetting(ctx, renewalWindowSetting, &window); err != nil {
+		return RenewalWindow{}, err
+	}
+	return window, nil
+}
+
+// renewalBonus returns the bonus of the next term: one more step after a claim-free term with its premiums paid up,
+// none after a claim or when premiums are outstanding
+func renewalBonus(policy *Policy, config NoClaimsBonusConfig, paidUp bool) NoClaimsBonus {
+	if policy.ClaimsPaid > 0 || !paidUp {
+		return NoClaimsBonus{Type: config.Type}
+	}
+
+	percent := config.StepPercent
+	// A bonus earned under another bonus type is carried over as is
+	percent += policy.NoClaimsBonus.Percent
+	percent = math.Min(percent, config.MaxPercent)
+
+	return NoClaimsBonus{Type: config.Type, Percent: percent}
+}
+
+// renewalTerms removes the bonus of the current term to find its base terms and applies the new bonus to them
+func renewalTerms(policy *Policy, bonus NoClaimsBonus) PricedTerms {
+	terms := PricedTerms{
+		PackageName:   policy.PackageName,
+		Premium:       policy.Premium,
+		Coverage:      policy.Coverage,
+		InstallmentNo: policy.InstallmentNo,
+		MaturityModel: policy.MaturityModel,
+		HealthTerms:   policy.HealthTerms,
+		TermMonths:    policy.TermMonths,
+	}
+
+	switch policy.NoClaimsBonus.Type {
+	case SumInsuredBonus:
+		terms.HealthTerms.SumInsured /= 1 + policy.NoClaimsBonus.Percent/100
+	case PremiumDiscountBonus:
+		terms.Premium /= 1 - policy.NoClaimsBonus.Percent/100
+	}
+
+	switch bonus.Type {
+	case SumInsuredBonus:
+		terms.HealthTerms.SumInsured *= 1 + bonus.Percent/100
+	case PremiumDiscountBonus:
+		terms.Premium *= 1 - bonus.Percent/100
+	}
+
+	terms.TotalPremiumToPay = terms.Premium * float64(terms.InstallmentNo)
+	return terms
+}
+
+// coverStart returns when the policy's continuous cover started, its own EffectiveDate unless it is a renewal
+func coverStart(policy *Policy) (time.Time, error) {
+	start := policy.ContinuousCoverSince
+	if start == "" {
+		start = policy.EffectiveDate
+	}
+
+	t, err := time.Parse(time.RFC3339, start)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse cover start date: %v", err)
+	}
+	return t, nil
+}
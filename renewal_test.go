@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRenewPolicy(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+	for i := 0; i < 18; i++ {
+		n.payPremium(id, "11112")
+	}
+
+	n.advance(340 * 24 * time.Hour)
+	n.mustFail("stranger", "only the holder of policy", "RenewPolicy", policyID)
+
+	renewalID, err := strconv.Atoi(n.mustInvoke("holder", "RenewPolicy", policyID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewal := n.policy(renewalID)
+	if renewal.NoClaimsBonus.Percent != 10 || renewal.HealthTerms.SumInsured != n.policy(id).HealthTerms.SumInsured*1.1 {
+		t.Errorf("renewal bonus = %v%% on a sum insured of %v, want 10%% more cover", renewal.NoClaimsBonus.Percent, renewal.HealthTerms.SumInsured)
+	}
+
+	// The renewed term only covers treatment from its effective date
+	n.payPremium(renewalID, "11112")
+	n.mustFail("holder", "is not in force", "SubmitHealthClaim", strconv.Itoa(renewalID), `{"MemberName":"","DiagnosisCode":"FRACTURE","ProcedureCode":"","RoomDays":0,"RoomRentPerDay":0,"TreatmentAmount":15000}`)
+}
+
+func TestRenewPolicyWithoutPremiumsEarnsNoBonus(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	n.payPremium(id, "11112")
+
+	n.advance(340 * 24 * time.Hour)
+	renewalID, err := strconv.Atoi(n.mustInvoke("holder", "RenewPolicy", strconv.Itoa(id)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renewal := n.policy(renewalID); renewal.NoClaimsBonus.Percent != 0 {
+		t.Errorf("renewal bonus = %v%% after one of 18 premiums, want none", renewal.NoClaimsBonus.Percent)
+	}
+}
@@ -95,33 +95,60 @@ async function getInstallmentNo(req, res) {
     }
 }
 
-async function setInstallmentNo(req, res) {
-    const { id, newInstallmentNo } = req.body;
-    console.log(`Received request to set new installment number for policy ID ${id} to: ${newInstallmentNo}`);
+async function requestInstallmentChange(req, res) {
+    const { id, newInstallmentNo, effectiveDate } = req.body;
+    console.log(`Received request to change installment number for policy ID ${id} to: ${newInstallmentNo}`);
 
     try {
-        await submitTransaction('SetInstallmentNo', id.toString(), newInstallmentNo.toString());
-        console.log(`Successfully set new installment number for policy ID ${id} to: ${newInstallmentNo}`);
-        res.status(200).send(`Installment number for policy ID ${id} set to ${newInstallmentNo}`);
+        await submitTransaction('RequestInstallmentChange', id.toString(), newInstallmentNo.toString(), effectiveDate || '');
+        console.log(`Requested installment change for policy ID ${id} to: ${newInstallmentNo}`);
+        res.status(200).send(`Installment change for policy ID ${id} to ${newInstallmentNo} requested, awaiting underwriter approval`);
     } catch (error) {
-        console.error(`Failed to set installment number for policy ID ${id}: ${error}`);
-        res.status(500).send(`Failed to set installment number: ${error}`);
+        console.error(`Failed to request installment change for policy ID ${id}: ${error}`);
+        res.status(500).send(`Failed to request installment change: ${error}`);
+    }
+}
+
+async function approveEndorsement(req, res) {
+    const { id, number } = req.body;
+    console.log(`Received request to approve endorsement ${number} of policy ID ${id}`);
+
+    try {
+        await submitTransaction('ApproveEndorsement', id.toString(), number.toString());
+        console.log(`Approved endorsement ${number} of policy ID ${id}`);
+        res.status(200).send(`Endorsement ${number} of policy ID ${id} approved`);
+    } catch (error) {
+        console.error(`Failed to approve endorsement ${number} of policy ID ${id}: ${error}`);
+        res.status(500).send(`Failed to approve endorsement: ${error}`);
+    }
+}
+
+async function getPolicyEndorsements(req, res) {
+    const { id } = req.params;
+    try {
+        const result = await evaluateTransaction('GetPolicyEndorsements', id.toString());
+        res.status(200).json(result);
+    } catch (error) {
+        res.status(500).send(`Failed to get endorsements: ${error}`);
     }
 }
 
 async function createLifeInsurancePolicy  (req, res)  {
-    const { holderName, age, location, companyName, packageName, premium, installmentNo, profitPercentage } = req.body;
+    const { holderName, age, gender, location, companyName, packageName, product, tableId, sumAssured, termYears, interestRate } = req.body;
     try {
         await submitTransaction(
             'CreateLifeInsurancePolicy',
             holderName,
             age.toString(),
+            gender,
             location,
             companyName,
-            packageName,
-            premium.toString(),
-            installmentNo.toString(),
-            profitPercentage.toString()
+            packageName || '',
+            product || '',
+            tableId || '',
+            (sumAssured || 0).toString(),
+            (termYears || 0).toString(),
+            (interestRate || 0).toString()
         );
         res.status(201).send('Life insurance policy created successfully');
     } catch (error) {
@@ -176,13 +203,24 @@ async function getPolicy(req, res) {
     }
 }
 
-async function claimCoverage(req, res) {
-    const { id } = req.body;
+async function patchPolicy(req, res) {
+    const { id } = req.params;
+    const { patch, fieldMask, expectedVersion } = req.body;
+    console.log(`Received request to patch policy with ID: ${id}`);
+
     try {
-        await submitTransaction('ClaimCoverage', id.toString());
-        res.status(200).send('Coverage claimed successfully');
+        await submitTransaction(
+            'PatchPolicy',
+            id.toString(),
+            JSON.stringify(patch || {}),
+            (fieldMask || []).join(','),
+            (expectedVersion || 0).toString()
+        );
+        console.log(`Successfully patched policy with ID: ${id}`);
+        res.status(200).send(`Policy with ID ${id} has been updated`);
     } catch (error) {
-        res.status(500).send(`Failed to claim coverage: ${error}`);
+        console.error(`Failed to patch policy with ID: ${id} - Error: ${error}`);
+        res.status(500).send(`Failed to patch policy: ${error}`);
     }
 }
 
@@ -311,12 +349,14 @@ async function updateProfitPercentageDefault(req, res) {
 module.exports = {
     initLedger,
     getInstallmentNo,
-    setInstallmentNo,
+    requestInstallmentChange,
+    approveEndorsement,
+    getPolicyEndorsements,
     createLifeInsurancePolicy,
     createHealthInsurancePolicy,
     payPremium,
     getPolicy,
-    claimCoverage,
+    patchPolicy,
     cancelPolicy,
     deletePolicy,
     getAllPolicies,
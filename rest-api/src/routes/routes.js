@@ -8,10 +8,12 @@ router.post('/createLifeInsurancePolicy', policyController.createLifeInsurancePo
 router.post('/createHealthInsurancePolicy', policyController.createHealthInsurancePolicy);
 router.post('/payPremium', policyController.payPremium);
 router.get('/policy/:id', policyController.getPolicy);
-router.post('/claimCoverage', policyController.claimCoverage);
+router.patch('/policy/:id', policyController.patchPolicy);
 router.post('/cancelPolicy', policyController.cancelPolicy);
 router.post('/deletePolicy', policyController.deletePolicy);
-router.post('/setInstallmentNo', policyController.setInstallmentNo);
+router.post('/requestInstallmentChange', policyController.requestInstallmentChange);
+router.post('/approveEndorsement', policyController.approveEndorsement);
+router.get('/endorsements/:id', policyController.getPolicyEndorsements);
 router.get('/getAll', policyController.getAllPolicies);
 
 
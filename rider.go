@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// RiderStatus represents the status of a rider attached to a policy
+type RiderStatus string
+
+const (
+	RiderActive  RiderStatus = "Active"
+	RiderRemoved RiderStatus = "Removed"
+	RiderClaimed RiderStatus = "Claimed"
+)
+
+// Rider names available in the catalog
+const (
+	AccidentalDeathRider = "AccidentalDeath"
+	CriticalIllnessRider = "CriticalIllness"
+	WaiverOfPremiumRider = "WaiverOfPremium"
+)
+
+// RiderDefinition describes an add-on cover that can be attached to a base policy.
+// Premium and coverage are percentages of the base policy's premium and coverage.
+type RiderDefinition struct {
+	Name            string   `json:"Name"`
+	PolicyTypes     []string `json:"PolicyTypes"`
+	PremiumPercent  float64  `json:"PremiumPercent"`
+	CoveragePercent float64  `json:"CoveragePercent"`
+	// TermInstallments limits the rider to that many installments after it is added, 0 means the rest of the policy
+	TermInstallments int `json:"TermInstallments"`
+	// WaitingInstallments must be paid after the rider is added before it can be claimed
+	WaitingInstallments int `json:"WaitingInstallments"`
+}
+
+// Rider is an add-on cover attached to a policy with its own term, status and claim eligibility
+type Rider struct {
+	Name             string      `json:"Name"`
+	Premium          float64     `json:"Premium"`
+	Coverage         float64     `json:"Coverage"`
+	StartInstallment int         `json:"StartInstallment"`
+	EndInstallment   int         `json:"EndInstallment"`
+	Status           RiderStatus `json:"Status"`
+	AddedAt          string      `json:"AddedAt"`
+}
+
+var riderCatalog = map[string]RiderDefinition{
+	AccidentalDeathRider: {
+		Name:            AccidentalDeathRider,
+		PolicyTypes:     []string{LifePolicy},
+		PremiumPercent:  5,
+		CoveragePercent: 100,
+	},
+	CriticalIllnessRider: {
+		Name:                CriticalIllnessRider,
+		PolicyTypes:         []string{LifePolicy, HealthPolicy},
+		PremiumPercent:      12,
+		CoveragePercent:     50,
+		WaitingInstallments: 1,
+	},
+	// A waiver-of-premium claim waives the remaining premiums of the base policy instead of paying out
+	WaiverOfPremiumRider: {
+		Name:                WaiverOfPremiumRider,
+		PolicyTypes:         []string{LifePolicy},
+		PremiumPercent:      3,
+		WaitingInstallments: 1,
+	},
+	// Add more riders as needed
+}
+
+// GetRiderCatalog returns the riders that can be attached to policies
+func (s *SmartContract) GetRiderCatalog(ctx contractapi.TransactionContextInterface) []RiderDefinition {
+	catalog := make([]RiderDefinition, 0, len(riderCatalog))
+	for _, name := range []string{AccidentalDeathRider, CriticalIllnessRider, WaiverOfPremiumRider} {
+		catalog = append(catalog, riderCatalog[name])
+	}
+	return catalog
+}
+
+// AddRider attaches a rider from the catalog to an active policy and adds its premium to the installments it covers.
+// Only the policy holder and the insurer can add riders.
+func (s *SmartContract) AddRider(ctx contractapi.TransactionContextInterface, id int, riderName string) error {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "add riders to it"); err != nil {
+		return err
+	}
+
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot add a rider to a policy that is not active")
+	}
+
+	definition, exists := riderCatalog[riderName]
+	if !exists {
+		return fmt.Errorf("rider %s does not exist", riderName)
+	}
+	if !containsString(definition.PolicyTypes, policy.PolicyType) {
+		return fmt.Errorf("rider %s is not available for %s policies", riderName, policy.PolicyType)
+	}
+	if activeRider(policy, riderName) != nil {
+		return fmt.Errorf("rider %s is already attached to policy %d", riderName, id)
+	}
+
+	remaining := policy.InstallmentNo - policy.PaymentCount
+	if remaining <= 0 {
+		return fmt.Errorf("cannot add a rider after all installments have been paid")
+	}
+
+	end := policy.InstallmentNo
+	if definition.TermInstallments > 0 && policy.PaymentCount+definition.TermInstallments < end {
+		end = policy.PaymentCount + definition.TermInstallments
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	rider := Rider{
+		Name:             riderName,
+		Premium:          policy.Premium * definition.PremiumPercent / 100,
+		Coverage:         policy.Coverage * definition.CoveragePercent / 100,
+		StartInstallment: policy.PaymentCount,
+		EndInstallment:   end,
+		Status:           RiderActive,
+		AddedAt:          now.Format(time.RFC3339),
+	}
+
+	policy.TotalPremiumToPay += rider.Premium * float64(end-policy.PaymentCount)
+	policy.Riders = append(policy.Riders, rider)
+
+	return putPolicy(ctx, policy)
+}
+
+// RemoveRider detaches an active rider and takes its premium off the installments not yet paid.
+// Only the policy holder and the insurer can remove riders.
+func (s *SmartContract) RemoveRider(ctx contractapi.TransactionContextInterface, id int, riderName string) error {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "remove its riders"); err != nil {
+		return err
+	}
+
+	rider := activeRider(policy, riderName)
+	if rider == nil {
+		return fmt.Errorf("rider %s is not active on policy %d", riderName, id)
+	}
+
+	endRider(policy, rider, RiderRemoved)
+
+	return putPolicy(ctx, policy)
+}
+
+// ClaimRider pays the coverage of an active rider, or waives the remaining premiums for a waiver-of-premium rider.
+// An accidental death rider is paid with the death benefit, see ClaimDeathBenefit.
+// Only the insurer can settle rider claims.
+func (s *SmartContract) ClaimRider(ctx contractapi.TransactionContextInterface, id int, riderName string) error {
+	if err := requireMSP(ctx, insurerMSPID, "settle rider claims"); err != nil {
+		return err
+	}
+
+	if riderName == AccidentalDeathRider {
+		return fmt.Errorf("rider %s is paid with the death benefit through ClaimDeathBenefit", riderName)
+	}
+
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if policy.PolicyStatus != Active {
+		return fmt.Errorf("cannot claim a rider on a policy that is not active")
+	}
+
+	rider, err := claimableRider(policy, riderName)
+	if err != nil {
+		return err
+	}
+
+	if riderName == WaiverOfPremiumRider {
+		policy.PremiumsWaived = true
+	} else {
+		if err := postAndCommit(ctx, ClaimEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(policy), rider.Coverage, riderName+" rider claim"); err != nil {
+			return err
+		}
+		policy.ClaimsPaid += rider.Coverage
+	}
+	endRider(policy, rider, RiderClaimed)
+
+	return putPolicy(ctx, policy)
+}
+
+// GetInstallmentDue returns the premium due for the next installment of a policy
+func (s *SmartContract) GetInstallmentDue(ctx contractapi.TransactionContextInterface, id int) (float64, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+
+	if policy.PremiumsWaived || policy.PaymentCount >= policy.InstallmentNo {
+		return 0, nil
+	}
+
+	return installmentDue(policy, policy.PaymentCount), nil
+}
+
+// installmentDue is the base premium plus the premiums of the active riders covering the installment,
+// counted from 0 like PaymentCount
+func installmentDue(policy *Policy, installment int) float64 {
+	due := policy.Premium
+	for _, rider := range policy.Riders {
+		if rider.Status == RiderActive && rider.StartInstallment <= installment && installment < rider.EndInstallment {
+			due += rider.Premium
+		}
+	}
+	return due
+}
+
+// remainingRiderPremiums is the premium of the active riders over the installments not yet paid
+func remainingRiderPremiums(policy *Policy) float64 {
+	var total float64
+	for _, rider := range policy.Riders {
+		if rider.Status == RiderActive && policy.PaymentCount < rider.EndInstallment {
+			total += rider.Premium * float64(rider.EndInstallment-policy.PaymentCount)
+		}
+	}
+	return total
+}
+
+// claimableRider returns the active rider when its waiting installments are paid and it has not expired
+func claimableRider(policy *Policy, riderName string) (*Rider, error) {
+	rider := activeRider(policy, riderName)
+	if rider == nil {
+		return nil, fmt.Errorf("rider %s is not active on policy %d", riderName, policy.ID)
+	}
+
+	definition := riderCatalog[riderName]
+	if policy.PaymentCount < rider.StartInstallment+definition.WaitingInstallments {
+		return nil, fmt.Errorf("rider %s can only be claimed after %d installments have been paid since it was added", riderName, definition.WaitingInstallments)
+	}
+	if policy.PaymentCount > rider.EndInstallment {
+		return nil, fmt.Errorf("rider %s has expired", riderName)
+	}
+
+	return rider, nil
+}
+
+// endRider stops an active rider and takes its premium off the installments not yet paid
+func endRider(policy *Policy, rider *Rider, status RiderStatus) {
+	if policy.PaymentCount < rider.EndInstallment {
+		policy.TotalPremiumToPay -= rider.Premium * float64(rider.EndInstallment-policy.PaymentCount)
+	}
+	rider.Status = status
+}
+
+// activeRider returns a pointer into the policy's riders so callers can update it in place
+func activeRider(policy *Policy, riderName string) *Rider {
+	for i := range policy.Riders {
+		if policy.Riders[i].Name == riderName && policy.Riders[i].Status == RiderActive {
+			return &policy.Riders[i]
+		}
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestClaimRider(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+
+	n.mustFail("stranger", "only the holder of policy", "AddRider", policyID, CriticalIllnessRider)
+	n.mustInvoke("holder", "AddRider", policyID, CriticalIllnessRider)
+
+	// The rider premium is collected with the installment on top of the base premium
+	n.mustFail("holder", "must cover the rider premiums", "PayPremium", policyID, "1000")
+	n.payPremium(id, "12445.44")
+
+	n.mustFail("holder", "only members of Org1MSP can settle rider claims", "ClaimRider", policyID, CriticalIllnessRider)
+	n.mustInvoke("insurer", "ClaimRider", policyID, CriticalIllnessRider)
+
+	policy := n.policy(id)
+	if policy.ClaimsPaid != policy.Coverage/2 {
+		t.Errorf("claims paid = %v, want half the coverage of %v", policy.ClaimsPaid, policy.Coverage)
+	}
+	if policy.Riders[0].Status != RiderClaimed {
+		t.Errorf("rider status = %s, want %s", policy.Riders[0].Status, RiderClaimed)
+	}
+}
+
+func TestRemoveRider(t *testing.T) {
+	n := newTestNetwork(t)
+	id := n.healthPolicy()
+	policyID := strconv.Itoa(id)
+
+	n.mustInvoke("holder", "AddRider", policyID, CriticalIllnessRider)
+	withRider := n.policy(id).TotalPremiumToPay
+
+	n.mustFail("stranger", "only the holder of policy", "RemoveRider", policyID, CriticalIllnessRider)
+	n.mustInvoke("holder", "RemoveRider", policyID, CriticalIllnessRider)
+
+	policy := n.policy(id)
+	if policy.TotalPremiumToPay >= withRider {
+		t.Errorf("total premium %v was not reduced from %v", policy.TotalPremiumToPay, withRider)
+	}
+	n.payPremium(id, "1000")
+}
+
+func TestWaiverOfPremiumNeedsInsurer(t *testing.T) {
+	n := newTestNetwork(t)
+	id := lifePolicy(n)
+	policyID := strconv.Itoa(id)
+
+	n.mustInvoke("holder", "AddRider", policyID, WaiverOfPremiumRider)
+	var due float64
+	n.mustInvokeJSON(&due, "holder", "GetInstallmentDue", policyID)
+	n.payPremium(id, strconv.FormatFloat(due, 'f', -1, 64))
+
+	// A holder cannot waive their own premiums and let the policy mature unpaid
+	n.mustFail("holder", "only members of Org1MSP can settle rider claims", "ClaimRider", policyID, WaiverOfPremiumRider)
+	if n.policy(id).PremiumsWaived {
+		t.Fatal("premiums were waived without the insurer")
+	}
+
+	n.mustInvoke("insurer", "ClaimRider", policyID, WaiverOfPremiumRider)
+	n.mustInvokeJSON(&due, "holder", "GetInstallmentDue", policyID)
+	if due != 0 {
+		t.Errorf("installment due after the waiver = %v, want 0", due)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Declare the object type for contract settings stored in the ledger
+const settingObjectType = "Setting"
+
+// adminMSPID is the organization allowed to change contract settings
+const adminMSPID = "Org1MSP"
+
+// insurerMSPID is the organization of the insurer's staff
+const insurerMSPID = "Org1MSP"
+
+// readSetting reads the named setting from the ledger into value, leaving value at its default when it was never set
+func readSetting(ctx contractapi.TransactionContextInterface, name string, value interface{}) error {
+	key, err := ctx.GetStub().CreateCompositeKey(settingObjectType, []string{name})
+	if err != nil {
+		return err
+	}
+
+	settingJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to read setting %s: %v", name, err)
+	}
+	if settingJSON == nil {
+		return nil
+	}
+
+	return json.Unmarshal(settingJSON, value)
+}
+
+// putSetting stores the named setting in the ledger after checking that the caller is an administrator
+func putSetting(ctx contractapi.TransactionContextInterface, name string, value interface{}) error {
+	if err := requireMSP(ctx, adminMSPID, "change contract settings"); err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(settingObjectType, []string{name})
+	if err != nil {
+		return err
+	}
+
+	settingJSON, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, settingJSON)
+}
+
+// requireHolderOrInsurer checks that the caller is the holder of the policy or a member of the insurer's organization
+func requireHolderOrInsurer(ctx contractapi.TransactionContextInterface, policy *Policy, action string) error {
+	caller, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity: %v", err)
+	}
+	if policy.HolderID != "" && caller == policy.HolderID {
+		return nil
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP: %v", err)
+	}
+	if clientMSPID != insurerMSPID {
+		return fmt.Errorf("only the holder of policy %d or members of %s can %s", policy.ID, insurerMSPID, action)
+	}
+	return nil
+}
+
+// requireMSP checks that the caller belongs to the given organization
+func requireMSP(ctx contractapi.TransactionContextInterface, mspID string, action string) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP: %v", err)
+	}
+	if clientMSPID != mspID {
+		return fmt.Errorf("only members of %s can %s", mspID, action)
+	}
+	return nil
+}
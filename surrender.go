@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Declare the default number of policy years that must be completed before a life policy can be surrendered
+// and the setting overriding it
+const (
+	defaultMinSurrenderYears = 3
+	minSurrenderYearsSetting = "minSurrenderYears"
+)
+
+// surrenderChargeSchedule is the percentage of the fund value kept by the insurer on surrender,
+// indexed by policy year starting at year 1; years beyond the schedule carry no charge
+var surrenderChargeSchedule = []float64{100, 60, 40, 30, 20, 10, 5}
+
+// SurrenderQuote breaks down what a life policy would pay if surrendered now
+type SurrenderQuote struct {
+	PolicyID                 int     `json:"PolicyID"`
+	PolicyYear               int     `json:"PolicyYear"`
+	TotalPaid                float64 `json:"TotalPaid"`
+	FundValue                float64 `json:"FundValue"`
+	SurrenderChargePercent   float64 `json:"SurrenderChargePercent"`
+	SurrenderCharge          float64 `json:"SurrenderCharge"`
+	AccruedBonus             float64 `json:"AccruedBonus"`
+	GuaranteedSurrenderValue float64 `json:"GuaranteedSurrenderValue"`
+	SurrenderValue           float64 `json:"SurrenderValue"`
+}
+
+// GetSurrenderQuote returns the surrender value of a life policy without changing it
+func (s *SmartContract) GetSurrenderQuote(ctx contractapi.TransactionContextInterface, id int) (*SurrenderQuote, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return surrenderQuote(ctx, policy)
+}
+
+// SurrenderPolicy ends a life policy early and credits its surrender value to the user's balance.
+// Only the policy holder and the insurer can surrender a policy.
+func (s *SmartContract) SurrenderPolicy(ctx contractapi.TransactionContextInterface, id int) error {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := requireHolderOrInsurer(ctx, policy, "surrender it"); err != nil {
+		return err
+	}
+
+	quote, err := surrenderQuote(ctx, policy)
+	if err != nil {
+		return err
+	}
+
+	if err := postAndCommit(ctx, SurrenderEntry, id, insurerAccountRef(policy.CompanyName), customerAccountRef(policy), quote.SurrenderValue, "Surrender value"); err != nil {
+		return err
+	}
+	policy.PolicyStatus = Surrendered
+
+	return putPolicy(ctx, policy)
+}
+
+// surrenderQuote values the premiums paid so far with the policy's maturity model, applies the
+// surrender charge for the current policy year and never pays less than the guaranteed surrender value
+func surrenderQuote(ctx contractapi.TransactionContextInterface, policy *Policy) (*SurrenderQuote, error) {
+	if policy.PolicyType != LifePolicy {
+		return nil, fmt.Errorf("only life policies can be surrendered")
+	}
+	if policy.PolicyStatus != Active {
+		return nil, fmt.Errorf("cannot surrender a policy that is not active")
+	}
+	if policy.PaymentCount == 0 {
+		return nil, fmt.Errorf("no premiums have been paid on policy %d", policy.ID)
+	}
+
+	model := policy.MaturityModel
+	if model.Type == "" {
+		model = defaultMaturityModel(0)
+	}
+	if err := model.validate(); err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	years, err := policyYear(policy, now)
+	if err != nil {
+		return nil, err
+	}
+
+	minYears, err := minSurrenderYears(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// policyYear counts the current year, so the years before it are complete
+	if years-1 < minYears {
+		return nil, fmt.Errorf("policy can only be surrendered after %d policy years, it is in year %d", minYears, years)
+	}
+	averagePremium := policy.TotalPaid / float64(policy.PaymentCount)
+
+	// The k-th annual premium grows from the start of policy year k+1 to the current policy year;
+	// premiums paid ahead of time have not grown yet
+	var fundValue, accruedBonus float64
+	for k := 0; k < policy.PaymentCount; k++ {
+		paidInYear := k
+		if paidInYear > years {
+			paidInYear = years
+		}
+		fundValue += model.accumulate(averagePremium, paidInYear, years)
+		if model.Type == GuaranteedPlusBonusModel {
+			accruedBonus += averagePremium * model.BonusRate / 100 * float64(years-paidInYear)
+		}
+	}
+
+	chargePercent := surrenderChargePercent(years)
+	charge := (fundValue - accruedBonus) * chargePercent / 100
+
+	guaranteed := policy.TotalPaid * guaranteedSurrenderFactor(years)
+	value := fundValue - charge
+	if value < guaranteed {
+		value = guaranteed
+	}
+
+	return &SurrenderQuote{
+		PolicyID:                 policy.ID,
+		PolicyYear:               years,
+		TotalPaid:                policy.TotalPaid,
+		FundValue:                fundValue,
+		SurrenderChargePercent:   chargePercent,
+		SurrenderCharge:          charge,
+		AccruedBonus:             accruedBonus,
+		GuaranteedSurrenderValue: guaranteed,
+		SurrenderValue:           value,
+	}, nil
+}
+
+// GetMinSurrenderYears returns how many policy years must be completed before a life policy can be surrendered
+func (s *SmartContract) GetMinSurrenderYears(ctx contractapi.TransactionContextInterface) (int, error) {
+	return minSurrenderYears(ctx)
+}
+
+// UpdateMinSurrenderYears updates how many policy years must be completed before a surrender; only administrators can change it
+func (s *SmartContract) UpdateMinSurrenderYears(ctx contractapi.TransactionContextInterface, years int) error {
+	if years < 0 {
+		return fmt.Errorf("minimum surrender years must not be negative")
+	}
+	return putSetting(ctx, minSurrenderYearsSetting, years)
+}
+
+func minSurrenderYears(ctx contractapi.TransactionContextInterface) (int, error) {
+	years := defaultMinSurrenderYears
+	if err := readSetting(ctx, minSurrenderYearsSetting, &years); err != nil {
+		return 0, err
+	}
+	return years, nil
+}
+
+func surrenderChargePercent(policyYear int) float64 {
+	if policyYear < 1 {
+		return 100
+	}
+	if policyYear > len(surrenderChargeSchedule) {
+		return 0
+	}
+	return surrenderChargeSchedule[policyYear-1]
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// lifePolicy issues a five-year endowment to the holder, priced from a flat test table, and returns its id
+func lifePolicy(n *testNetwork) int {
+	n.t.Helper()
+	n.mustInvoke("insurer", "LoadMortalityTable", "Test", "M", "40", "[0.01,0.01,0.01,0.01,0.01,0.01,0.01,0.01,0.01,0.01]")
+	n.mustInvoke("holder", "CreateLifeInsurancePolicy", "Bob", "40", "M", "Berlin", "Acme", "", string(EndowmentLife), "Test", "10000", "5", "4")
+	return n.lastPolicyID()
+}
+
+func TestSurrenderPolicy(t *testing.T) {
+	n := newTestNetwork(t)
+	id := lifePolicy(n)
+	policyID := strconv.Itoa(id)
+
+	// Paying the premiums early does not shorten the minimum surrender period
+	for i := 0; i < 3; i++ {
+		n.payPremium(id, "1800")
+	}
+	n.mustFail("holder", "after 3 policy years, it is in year 1", "SurrenderPolicy", policyID)
+
+	n.advance(3 * 366 * 24 * time.Hour)
+	n.mustFail("stranger", "only the holder of policy", "SurrenderPolicy", policyID)
+
+	var quote SurrenderQuote
+	n.mustInvokeJSON(&quote, "holder", "GetSurrenderQuote", policyID)
+	if quote.PolicyYear != 4 || quote.SurrenderValue <= 0 {
+		t.Errorf("surrender quote in year %d pays %v, want year 4 and a positive value", quote.PolicyYear, quote.SurrenderValue)
+	}
+
+	n.mustInvoke("holder", "SurrenderPolicy", policyID)
+	if policy := n.policy(id); policy.PolicyStatus != Surrendered {
+		t.Errorf("policy status = %s, want %s", policy.PolicyStatus, Surrendered)
+	}
+}
+
+func TestMinSurrenderYearsSetting(t *testing.T) {
+	n := newTestNetwork(t)
+	id := lifePolicy(n)
+	n.payPremium(id, "1800")
+
+	n.mustFail("holder", "can change contract settings", "UpdateMinSurrenderYears", "0")
+	n.mustInvoke("insurer", "UpdateMinSurrenderYears", "0")
+	n.mustInvoke("insurer", "SurrenderPolicy", strconv.Itoa(id))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Declare the default term of health policies issued without a package and the setting overriding it
+const (
+	defaultHealthTermMonths = 12
+	healthTermMonthsSetting = "healthTermMonths"
+)
+
+// maxExpiryBatchSize bounds how many policies one ExpirePolicies call may visit
+const maxExpiryBatchSize = 200
+
+// InstallmentDue is one premium installment of a policy and when it falls due
+type InstallmentDue struct {
+	Number  int    `json:"Number"`
+	DueDate string `json:"DueDate"`
+	Paid    bool   `json:"Paid"`
+}
+
+// InstallmentSchedule lists the installments of a policy over its term
+type InstallmentSchedule struct {
+	PolicyID       int              `json:"PolicyID"`
+	TermMonths     int              `json:"TermMonths"`
+	EffectiveDate  string           `json:"EffectiveDate"`
+	ExpirationDate string           `json:"ExpirationDate"`
+	MaturityDate   string           `json:"MaturityDate"`
+	Installments   []InstallmentDue `json:"Installments"`
+	// NextDueDate is empty once every installment is paid or premiums are waived
+	NextDueDate string `json:"NextDueDate"`
+	Overdue     bool   `json:"Overdue"`
+}
+
+// ExpiryBatch reports the outcome of one ExpirePolicies page
+type ExpiryBatch struct {
+	Expired []int `json:"Expired"`
+	NextID  int   `json:"NextID"`
+	Done    bool  `json:"Done"`
+}
+
+// GetInstallmentSchedule returns the due dates of the installments of a policy, spread evenly over its term
+func (s *SmartContract) GetInstallmentSchedule(ctx contractapi.TransactionContextInterface, id int) (*InstallmentSchedule, error) {
+	policy, err := s.ReadPolicy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dueDates, err := installmentDueDates(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := InstallmentSchedule{
+		PolicyID:       id,
+		TermMonths:     policy.TermMonths,
+		EffectiveDate:  policy.EffectiveDate,
+		ExpirationDate: policy.ExpirationDate,
+		MaturityDate:   policy.MaturityDate,
+		Installments:   make([]InstallmentDue, len(dueDates)),
+	}
+
+	for i, dueDate := range dueDates {
+		paid := i < policy.PaymentCount
+		schedule.Installments[i] = InstallmentDue{Number: i + 1, DueDate: dueDate.Format(time.RFC3339), Paid: paid}
+
+		if !paid && !policy.PremiumsWaived && schedule.NextDueDate == "" {
+			schedule.NextDueDate = dueDate.Format(time.RFC3339)
+			schedule.Overdue = policy.PolicyStatus == Active && now.After(dueDate)
+		}
+	}
+
+	return &schedule, nil
+}
+
+// ExpirePolicies visits up to batchSize policies starting at startID and moves every active policy past its
+// ExpirationDate to Expired. Life policies due to mature are left to ProcessMaturities, which pays them out.
+// Call again with NextID until Done is true.
+func (s *SmartContract) ExpirePolicies(ctx contractapi.TransactionContextInterface, startID int, batchSize int) (*ExpiryBatch, error) {
+	if startID < 1 {
+		startID = 1
+	}
+	if batchSize <= 0 || batchSize > maxExpiryBatchSize {
+		return nil, fmt.Errorf("batch size must be between 1 and %d", maxExpiryBatchSize)
+	}
+
+	totalPolicies, err := s.GetTotalPoliciesCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := ExpiryBatch{Expired: []int{}}
+
+	id := startID
+	for ; id < startID+batchSize && id <= totalPolicies; id++ {
+		policyJSON, err := ctx.GetStub().GetState(strconv.Itoa(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read policy %d: %v", id, err)
+		}
+		// Deleted policies leave gaps in the id sequence
+		if policyJSON == nil {
+			continue
+		}
+
+		var policy Policy
+		if err := json.Unmarshal(policyJSON, &policy); err != nil {
+			return nil, err
+		}
+
+		if policy.PolicyStatus != Active {
+			continue
+		}
+
+		expirationDate, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse expiration date of policy %d: %v", id, err)
+		}
+		if now.Before(expirationDate) {
+			continue
+		}
+
+		due, err := maturityDue(&policy, now)
+		if err != nil {
+			return nil, err
+		}
+		if due {
+			continue
+		}
+
+		policy.PolicyStatus = Expired
+		if err := putPolicy(ctx, &policy); err != nil {
+			return nil, err
+		}
+		batch.Expired = append(batch.Expired, id)
+	}
+
+	batch.NextID = id
+	batch.Done = id > totalPolicies
+
+	return &batch, nil
+}
+
+// GetHealthTermMonths returns the term of health policies issued without a package
+func (s *SmartContract) GetHealthTermMonths(ctx contractapi.TransactionContextInterface) (int, error) {
+	return healthTermMonths(ctx)
+}
+
+// UpdateHealthTermMonths updates the term of health policies issued without a package; only administrators can change it
+func (s *SmartContract) UpdateHealthTermMonths(ctx contractapi.TransactionContextInterface, months int) error {
+	if months <= 0 {
+		return fmt.Errorf("term must be greater than 0 months")
+	}
+	return putSetting(ctx, healthTermMonthsSetting, months)
+}
+
+func healthTermMonths(ctx contractapi.TransactionContextInterface) (int, error) {
+	months := defaultHealthTermMonths
+	if err := readSetting(ctx, healthTermMonthsSetting, &months); err != nil {
+		return 0, err
+	}
+	return months, nil
+}
+
+// policyTermMonths returns the term of a new policy: the package term when it has one, otherwise the
+// health term for health policies and one year per annual installment for life policies
+func policyTermMonths(ctx contractapi.TransactionContextInterface, policyType string, packageName string, installmentNo int) (int, error) {
+	if insurancePackage, ok := packages[packageName]; ok {
+		months := insurancePackage.TermMonths
+		if policyType == HealthPolicy {
+			months = insurancePackage.HealthTerms.TermMonths
+		}
+		if months > 0 {
+			return months, nil
+		}
+	}
+
+	if policyType == HealthPolicy {
+		return healthTermMonths(ctx)
+	}
+	return installmentNo * 12, nil
+}
+
+// fillTermMonths derives the term of priced terms that do not set one, see policyTermMonths
+func fillTermMonths(ctx contractapi.TransactionContextInterface, policyType string, terms *PricedTerms) error {
+	if terms.TermMonths > 0 {
+		return nil
+	}
+
+	months, err := policyTermMonths(ctx, policyType, terms.PackageName, terms.InstallmentNo)
+	if err != nil {
+		return err
+	}
+	terms.TermMonths = months
+	return nil
+}
+
+// installmentDueDates spreads the installments evenly over the term, the first one due on the EffectiveDate.
+// When the term divides into whole months per installment the due dates fall on the same day of the month.
+func installmentDueDates(policy *Policy) ([]time.Time, error) {
+	effectiveDate, err := time.Parse(time.RFC3339, policy.EffectiveDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse effective date: %v", err)
+	}
+	expirationDate, err := time.Parse(time.RFC3339, policy.ExpirationDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expiration date: %v", err)
+	}
+
+	n := policy.InstallmentNo
+	dueDates := make([]time.Time, n)
+	for k := 0; k < n; k++ {
+		if policy.TermMonths > 0 && policy.TermMonths%n == 0 {
+			dueDates[k] = effectiveDate.AddDate(0, k*policy.TermMonths/n, 0)
+		} else {
+			term := expirationDate.Sub(effectiveDate)
+			dueDates[k] = effectiveDate.Add(time.Duration(float64(term) * float64(k) / float64(n)))
+		}
+	}
+
+	return dueDates, nil
+}
+
+// installmentsDueBy counts the installments whose due date has been reached at the given time
+func installmentsDueBy(policy *Policy, now time.Time) (int, error) {
+	dueDates, err := installmentDueDates(policy)
+	if err != nil {
+		return 0, err
+	}
+
+	due := 0
+	for _, dueDate := range dueDates {
+		if !now.Before(dueDate) {
+			due++
+		}
+	}
+	return due, nil
+}
@@ -0,0 +1,169 @@
+// Package token is a minimal fungible token contract used to pay insurance premiums on the same channel.
+// Accounts are the client identity IDs of their owners, so a transfer always debits the caller.
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const (
+	balanceObjectType = "balance"
+	totalSupplyKey    = "totalSupply"
+)
+
+// Declare the MSP allowed to mint new tokens
+var MinterMSPID = "Org1MSP"
+
+// TokenContract provides functions for minting and transferring tokens
+type TokenContract struct {
+	contractapi.Contract
+}
+
+// TransferEvent is emitted for every mint and transfer
+type TransferEvent struct {
+	From   string  `json:"from"`
+	To     string  `json:"to"`
+	Amount float64 `json:"amount"`
+}
+
+// Mint creates new tokens in the caller's account; only members of the minter MSP can mint
+func (t *TokenContract) Mint(ctx contractapi.TransactionContextInterface, amount float64) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client MSP: %v", err)
+	}
+	if mspID != MinterMSPID {
+		return fmt.Errorf("client is not authorized to mint new tokens")
+	}
+	if amount <= 0 {
+		return fmt.Errorf("mint amount must be greater than zero")
+	}
+
+	minter, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	balance, err := readBalance(ctx, minter)
+	if err != nil {
+		return err
+	}
+	if err := putBalance(ctx, minter, balance+amount); err != nil {
+		return err
+	}
+
+	supply, err := t.TotalSupply(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.FormatFloat(supply+amount, 'f', -1, 64))); err != nil {
+		return err
+	}
+
+	return emitTransfer(ctx, TransferEvent{From: "", To: minter, Amount: amount})
+}
+
+// Transfer moves amount from the caller's account to the recipient and returns the transfer id
+func (t *TokenContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount float64) (string, error) {
+	sender, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	if recipient == "" {
+		return "", fmt.Errorf("recipient must not be empty")
+	}
+	if recipient == sender {
+		return "", fmt.Errorf("cannot transfer to and from the same account")
+	}
+	if amount <= 0 {
+		return "", fmt.Errorf("transfer amount must be greater than zero")
+	}
+
+	senderBalance, err := readBalance(ctx, sender)
+	if err != nil {
+		return "", err
+	}
+	if senderBalance < amount {
+		return "", fmt.Errorf("insufficient funds: balance %v, transfer %v", senderBalance, amount)
+	}
+
+	recipientBalance, err := readBalance(ctx, recipient)
+	if err != nil {
+		return "", err
+	}
+
+	if err := putBalance(ctx, sender, senderBalance-amount); err != nil {
+		return "", err
+	}
+	if err := putBalance(ctx, recipient, recipientBalance+amount); err != nil {
+		return "", err
+	}
+
+	if err := emitTransfer(ctx, TransferEvent{From: sender, To: recipient, Amount: amount}); err != nil {
+		return "", err
+	}
+
+	return ctx.GetStub().GetTxID(), nil
+}
+
+// BalanceOf returns the balance of the given account
+func (t *TokenContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (float64, error) {
+	return readBalance(ctx, account)
+}
+
+// ClientAccountID returns the account id of the caller, to be used as a transfer recipient
+func (t *TokenContract) ClientAccountID(ctx contractapi.TransactionContextInterface) (string, error) {
+	id, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client id: %v", err)
+	}
+	return id, nil
+}
+
+// TotalSupply returns the number of tokens minted so far
+func (t *TokenContract) TotalSupply(ctx contractapi.TransactionContextInterface) (float64, error) {
+	supplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read total supply: %v", err)
+	}
+	if supplyBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseFloat(string(supplyBytes), 64)
+}
+
+func readBalance(ctx contractapi.TransactionContextInterface, account string) (float64, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(balanceObjectType, []string{account})
+	if err != nil {
+		return 0, err
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance of %s: %v", account, err)
+	}
+	if balanceBytes == nil {
+		return 0, nil
+	}
+	return strconv.ParseFloat(string(balanceBytes), 64)
+}
+
+func putBalance(ctx contractapi.TransactionContextInterface, account string, balance float64) error {
+	key, err := ctx.GetStub().CreateCompositeKey(balanceObjectType, []string{account})
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().PutState(key, []byte(strconv.FormatFloat(balance, 'f', -1, 64)))
+}
+
+func emitTransfer(ctx contractapi.TransactionContextInterface, event TransferEvent) error {
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return ctx.GetStub().SetEvent("Transfer", eventJSON)
+}
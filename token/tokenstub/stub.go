@@ -0,0 +1,343 @@
+// Package tokenstub runs chaincodes in memory so the premium payment flow through the token chaincode
+// can be exercised without a Fabric network. Like a peer, a transaction reads the committed state only,
+// and its writes, including those of chaincodes it invokes, are committed when it succeeds.
+package tokenstub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go/msp"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ChannelID is the channel every stubbed chaincode is deployed on
+const ChannelID = "stubchannel"
+
+// Network holds the deployed chaincodes and their committed world state
+type Network struct {
+	chaincodes map[string]shim.Chaincode
+	state      map[string]map[string][]byte
+	creator    []byte
+	transient  map[string][]byte
+	now        time.Time
+	txCount    int
+}
+
+// NewNetwork creates an empty network whose clock starts at now
+func NewNetwork(now time.Time) *Network {
+	return &Network{
+		chaincodes: make(map[string]shim.Chaincode),
+		state:      make(map[string]map[string][]byte),
+		now:        now,
+	}
+}
+
+// Deploy registers a chaincode under the name other chaincodes invoke it by
+func (n *Network) Deploy(name string, chaincode shim.Chaincode) {
+	n.chaincodes[name] = chaincode
+	if n.state[name] == nil {
+		n.state[name] = make(map[string][]byte)
+	}
+}
+
+// SetCreator sets the serialized identity submitting the next transactions, see NewIdentity
+func (n *Network) SetCreator(creator []byte) {
+	n.creator = creator
+}
+
+// SetTransient sets the transient data passed to the next transactions
+func (n *Network) SetTransient(transient map[string][]byte) {
+	n.transient = transient
+}
+
+// Advance moves the transaction clock forward
+func (n *Network) Advance(d time.Duration) {
+	n.now = n.now.Add(d)
+}
+
+// Invoke submits a transaction to a chaincode and commits its writes when it succeeds
+func (n *Network) Invoke(name string, args ...string) pb.Response {
+	n.txCount++
+	n.now = n.now.Add(time.Second)
+
+	tx := &transaction{id: fmt.Sprintf("tx%06d", n.txCount), timestamp: n.now}
+
+	byteArgs := make([][]byte, len(args))
+	for i, arg := range args {
+		byteArgs[i] = []byte(arg)
+	}
+
+	stub, response := n.invoke(tx, name, byteArgs)
+	if response.Status < shim.ERRORTHRESHOLD {
+		n.commit(stub.writes)
+	}
+	return response
+}
+
+// State returns the committed value of a key in a chaincode's world state
+func (n *Network) State(name string, key string) []byte {
+	return n.state[name][key]
+}
+
+func (n *Network) invoke(tx *transaction, name string, args [][]byte) (*Stub, pb.Response) {
+	chaincode, ok := n.chaincodes[name]
+	if !ok {
+		return nil, shim.Error(fmt.Sprintf("chaincode %s is not deployed", name))
+	}
+
+	stub := &Stub{network: n, tx: tx, name: name, args: args, writes: make(map[string]map[string][]byte)}
+	return stub, chaincode.Invoke(stub)
+}
+
+func (n *Network) commit(writes map[string]map[string][]byte) {
+	for name, keys := range writes {
+		if n.state[name] == nil {
+			n.state[name] = make(map[string][]byte)
+		}
+		for key, value := range keys {
+			if value == nil {
+				delete(n.state[name], key)
+			} else {
+				n.state[name][key] = value
+			}
+		}
+	}
+}
+
+// NewIdentity returns a serialized identity with a self-signed certificate, to be used with SetCreator
+func NewIdentity(mspID string, commonName string) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{mspID}},
+		Issuer:       pkix.Name{CommonName: "ca." + mspID},
+		NotBefore:    time.Unix(0, 0),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: certPEM})
+}
+
+// transaction is shared by a transaction and the chaincodes it invokes
+type transaction struct {
+	id        string
+	timestamp time.Time
+}
+
+// Stub implements the parts of shim.ChaincodeStubInterface used by the contract API;
+// calling any other method panics
+type Stub struct {
+	shim.ChaincodeStubInterface
+	network *Network
+	tx      *transaction
+	name    string
+	args    [][]byte
+	// writes are keyed by chaincode name, a nil value deletes the key
+	writes map[string]map[string][]byte
+}
+
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		args[i] = string(arg)
+	}
+	return args
+}
+
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (s *Stub) GetTxID() string {
+	return s.tx.id
+}
+
+func (s *Stub) GetChannelID() string {
+	return ChannelID
+}
+
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return timestamppb.New(s.tx.timestamp), nil
+}
+
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.network.creator, nil
+}
+
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.network.transient, nil
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	return nil
+}
+
+// InvokeChaincode calls another chaincode in the same transaction; its writes are kept only when it succeeds
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	if channel != "" && channel != ChannelID {
+		return shim.Error(fmt.Sprintf("channel %s does not exist", channel))
+	}
+
+	called, response := s.network.invoke(s.tx, chaincodeName, args)
+	if response.Status < shim.ERRORTHRESHOLD {
+		for name, keys := range called.writes {
+			if s.writes[name] == nil {
+				s.writes[name] = make(map[string][]byte)
+			}
+			for key, value := range keys {
+				s.writes[name][key] = value
+			}
+		}
+	}
+	return response
+}
+
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return s.network.state[s.name][key], nil
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if s.writes[s.name] == nil {
+		s.writes[s.name] = make(map[string][]byte)
+	}
+	s.writes[s.name][key] = value
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	return s.PutState(key, nil)
+}
+
+// Private data is kept in the chaincode's own state under a collection prefix
+func (s *Stub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return s.GetState(privateKey(collection, key))
+}
+
+// GetPrivateDataHash returns the SHA-256 hash of a private value, as peers outside the collection see it
+func (s *Stub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	return s.PutState(privateKey(collection, key), value)
+}
+
+func (s *Stub) DelPrivateData(collection string, key string) error {
+	return s.PutState(privateKey(collection, key), nil)
+}
+
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	parts := strings.Split(strings.TrimPrefix(compositeKey, "\x00"), "\x00")
+	if len(parts) < 2 {
+		return "", nil, fmt.Errorf("%s is not a composite key", compositeKey)
+	}
+	return parts[0], parts[1 : len(parts)-1], nil
+}
+
+// GetStateByRange iterates the committed keys in [startKey, endKey) that are not composite keys
+func (s *Stub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	return s.iterator(func(key string) bool {
+		return !strings.HasPrefix(key, "\x00") && key >= startKey && (endKey == "" || key < endKey)
+	}), nil
+}
+
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	return s.iterator(func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	}), nil
+}
+
+func (s *Stub) iterator(match func(key string) bool) *iterator {
+	var keys []string
+	for key := range s.network.state[s.name] {
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	results := make([]*queryresult.KV, len(keys))
+	for i, key := range keys {
+		results[i] = &queryresult.KV{Namespace: s.name, Key: key, Value: s.network.state[s.name][key]}
+	}
+	return &iterator{results: results}
+}
+
+func privateKey(collection string, key string) string {
+	return "\x00" + string(utf8.MaxRune) + collection + "\x00" + key
+}
+
+type iterator struct {
+	results []*queryresult.KV
+	next    int
+}
+
+func (it *iterator) HasNext() bool {
+	return it.next < len(it.results)
+}
+
+func (it *iterator) Next() (*queryresult.KV, error) {
+	if !it.HasNext() {
+		return nil, fmt.Errorf("no more results")
+	}
+	it.next++
+	return it.results[it.next-1], nil
+}
+
+func (it *iterator) Close() error {
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const insurerTokenAccountObjectType = "InsurerTokenAccount"
+
+// Declare the default name of the token chaincode premiums are paid with, deployed on the same channel,
+// and the setting overriding it
+const (
+	defaultTokenChaincodeName = "token"
+	tokenChaincodeNameSetting = "tokenChaincodeName"
+)
+
+// InsurerTokenAccount links an insurer to the token account receiving its premiums
+type InsurerTokenAccount struct {
+	CompanyName    string `json:"CompanyName"`
+	TokenAccountID string `json:"TokenAccountID"`
+}
+
+// RegisterInsurerTokenAccount makes the caller's token account the one receiving the premiums of the company,
+// replacing any account registered before. Only the insurer can register token accounts.
+func (s *SmartContract) RegisterInsurerTokenAccount(ctx contractapi.TransactionContextInterface, companyName string) error {
+	if err := requireMSP(ctx, insurerMSPID, "register insurer token accounts"); err != nil {
+		return err
+	}
+
+	if companyName == "" {
+		return fmt.Errorf("company name must not be empty")
+	}
+
+	// Token accounts are client identity IDs, and InvokeChaincode passes on the same client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client id: %v", err)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(insurerTokenAccountObjectType, []string{companyName})
+	if err != nil {
+		return err
+	}
+
+	accountJSON, err := json.Marshal(InsurerTokenAccount{CompanyName: companyName, TokenAccountID: clientID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, accountJSON)
+}
+
+// GetInsurerTokenAccount returns the token account receiving the premiums of the company
+func (s *SmartContract) GetInsurerTokenAccount(ctx contractapi.TransactionContextInterface, companyName string) (*InsurerTokenAccount, error) {
+	account, err := readInsurerTokenAccount(ctx, companyName)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, fmt.Errorf("company %s has no token account", companyName)
+	}
+	return account, nil
+}
+
+// GetTokenChaincodeName returns the name of the token chaincode premiums are paid with
+func (s *SmartContract) GetTokenChaincodeName(ctx contractapi.TransactionContextInterface) (string, error) {
+	return tokenChaincodeName(ctx)
+}
+
+// UpdateTokenChaincodeName updates the name of the token chaincode premiums are paid with; only administrators can change it
+func (s *SmartContract) UpdateTokenChaincodeName(ctx contractapi.TransactionContextInterface, name string) error {
+	if name == "" {
+		return fmt.Errorf("token chaincode name must not be empty")
+	}
+	return putSetting(ctx, tokenChaincodeNameSetting, name)
+}
+
+func tokenChaincodeName(ctx contractapi.TransactionContextInterface) (string, error) {
+	name := defaultTokenChaincodeName
+	if err := readSetting(ctx, tokenChaincodeNameSetting, &name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// transferPremiumTokens transfers amount from the caller to the insurer's token account and returns the transfer id
+func transferPremiumTokens(ctx contractapi.TransactionContextInterface, companyName string, amount float64) (string, error) {
+	account, err := readInsurerTokenAccount(ctx, companyName)
+	if err != nil {
+		return "", err
+	}
+	if account == nil {
+		return "", fmt.Errorf("company %s has no token account to receive premiums", companyName)
+	}
+
+	chaincodeName, err := tokenChaincodeName(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	args := [][]byte{
+		[]byte("Transfer"),
+		[]byte(account.TokenAccountID),
+		[]byte(strconv.FormatFloat(amount, 'f', -1, 64)),
+	}
+
+	response := ctx.GetStub().InvokeChaincode(chaincodeName, args, "")
+	if response.Status != shim.OK {
+		return "", fmt.Errorf("token transfer failed: %s", response.Message)
+	}
+
+	return string(response.Payload), nil
+}
+
+func readInsurerTokenAccount(ctx contractapi.TransactionContextInterface, companyName string) (*InsurerTokenAccount, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(insurerTokenAccountObjectType, []string{companyName})
+	if err != nil {
+		return nil, err
+	}
+
+	accountJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token account of company %s: %v", companyName, err)
+	}
+	if accountJSON == nil {
+		return nil, nil
+	}
+
+	var account InsurerTokenAccount
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTokenPaymentNetwork starts a network where the insurer's token account receives the premiums of Acme
+// and the holder has 1000 tokens and a Silver health policy, whose id is returned
+func newTokenPaymentNetwork(t *testing.T) (*testNetwork, int) {
+	t.Helper()
+
+	n := newTestNetwork(t)
+	n.mustInvoke("insurer", "RegisterInsurerTokenAccount", "Acme")
+	n.tokenCompanies["Acme"] = true
+	n.mustInvokeToken("insurer", "Mint", "1000")
+	n.mustInvokeToken("insurer", "Transfer", n.mustInvokeToken("holder", "ClientAccountID"), "1000")
+
+	return n, n.healthPolicy()
+}
+
+func TestPayPremiumTransfersTokens(t *testing.T) {
+	n, id := newTokenPaymentNetwork(t)
+
+	n.mustInvoke("holder", "PayPremium", strconv.Itoa(id), "250")
+
+	if balance := n.tokenBalance("holder"); balance != 750 {
+		t.Errorf("holder balance = %v, want 750", balance)
+	}
+	if balance := n.tokenBalance("insurer"); balance != 250 {
+		t.Errorf("insurer balance = %v, want 250", balance)
+	}
+
+	policy := n.policy(id)
+	if policy.PaymentCount != 1 || policy.TotalPaid != 250 {
+		t.Errorf("policy has %d payments totalling %v, want 1 totalling 250", policy.PaymentCount, policy.TotalPaid)
+	}
+
+	var treasury Account
+	n.mustInvokeJSON(&treasury, "insurer", "GetAccount", "INSURER-Acme")
+	if treasury.Balance != 250 {
+		t.Errorf("insurer ledger balance = %v, want 250", treasury.Balance)
+	}
+}
+
+func TestPayPremiumFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(n *testNetwork)
+		amount  string
+		wantErr string
+	}{
+		{
+			name:    "insufficient balance",
+			amount:  "1500",
+			wantErr: "insufficient funds",
+		},
+		{
+			name: "token chaincode error",
+			setup: func(n *testNetwork) {
+				n.mustInvoke("insurer", "UpdateTokenChaincodeName", "missing")
+			},
+			amount:  "250",
+			wantErr: "token transfer failed",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, id := newTokenPaymentNetwork(t)
+			if test.setup != nil {
+				test.setup(n)
+			}
+
+			n.mustFail("holder", test.wantErr, "PayPremium", strconv.Itoa(id), test.amount)
+
+			if balance := n.tokenBalance("holder"); balance != 1000 {
+				t.Errorf("holder balance = %v, want 1000", balance)
+			}
+			if policy := n.policy(id); policy.PaymentCount != 0 || policy.TotalPaid != 0 {
+				t.Errorf("policy has %d payments totalling %v, want none", policy.PaymentCount, policy.TotalPaid)
+			}
+		})
+	}
+}
+
+func TestUpdateTokenChaincodeNameRequiresAdmin(t *testing.T) {
+	n, _ := newTokenPaymentNetwork(t)
+
+	n.mustFail("holder", "can change contract settings", "UpdateTokenChaincodeName", "missing")
+	if name := n.mustInvoke("holder", "GetTokenChaincodeName"); name != defaultTokenChaincodeName {
+		t.Errorf("token chaincode name = %s, want %s", name, defaultTokenChaincodeName)
+	}
+}
+
+func TestRegisterInsurerTokenAccount(t *testing.T) {
+	n, id := newTokenPaymentNetwork(t)
+
+	// A customer cannot divert a company's premiums to their own token account
+	n.mustFail("holder", "only members of Org1MSP can register insurer token accounts", "RegisterInsurerTokenAccount", "Acme")
+	n.mustFail("holder", "only members of Org1MSP can register insurer token accounts", "RegisterInsurerTokenAccount", "Newco")
+
+	// The insurer can move the company's premiums to another of its token accounts
+	n.mustInvoke("underwriter", "RegisterInsurerTokenAccount", "Acme")
+	var account InsurerTokenAccount
+	n.mustInvokeJSON(&account, "holder", "GetInsurerTokenAccount", "Acme")
+	if underwriter := n.mustInvokeToken("underwriter", "ClientAccountID"); account.TokenAccountID != underwriter {
+		t.Fatalf("Acme token account = %s, want the underwriter's %s", account.TokenAccountID, underwriter)
+	}
+
+	n.mustInvoke("holder", "PayPremium", strconv.Itoa(id), "100")
+	if balance := n.tokenBalance("underwriter"); balance != 100 {
+		t.Errorf("replacement account balance = %v, want 100", balance)
+	}
+}
+
+func TestBulkPayPremiumsTransfersTokens(t *testing.T) {
+	n, first := newTokenPaymentNetwork(t)
+	n.mustInvoke("holder", "CreateHealthInsurancePolicy", "Bob", "40", "Berlin", "Acme", "Gold", "0", "0", "0")
+	second := n.lastPolicyID()
+
+	n.mustInvoke("holder", "BulkPayPremiums", fmt.Sprintf(`[{"PolicyID":%d,"Amount":100},{"PolicyID":%d,"Amount":200}]`, first, second), "false")
+
+	if balance := n.tokenBalance("holder"); balance != 700 {
+		t.Errorf("holder balance = %v, want 700", balance)
+	}
+	if balance := n.tokenBalance("insurer"); balance != 300 {
+		t.Errorf("insurer balance = %v, want 300", balance)
+	}
+	if policy := n.policy(second); policy.PaymentCount != 1 || policy.TotalPaid != 200 {
+		t.Errorf("policy %d has %d payments totalling %v, want 1 totalling 200", second, policy.PaymentCount, policy.TotalPaid)
+	}
+
+	// A failed transfer writes nothing
+	n.advance(time.Minute)
+	if _, err := n.invoke("holder", "BulkPayPremiums", fmt.Sprintf(`[{"PolicyID":%d,"Amount":500},{"PolicyID":%d,"Amount":500}]`, first, second), "false"); err == nil {
+		t.Fatal("bulk payment above the holder's balance succeeded")
+	}
+	if policy := n.policy(first); policy.PaymentCount != 1 {
+		t.Errorf("policy %d has %d payments, want 1", first, policy.PaymentCount)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// balanceTolerance absorbs floating point noise when comparing summed amounts
+const balanceTolerance = 1e-6
+
+// CompanyBalance summarises the treasury account of an insurer from its journal entries
+type CompanyBalance struct {
+	CompanyName      string  `json:"CompanyName"`
+	AccountID        string  `json:"AccountID"`
+	Balance          float64 `json:"Balance"`
+	PremiumsReceived float64 `json:"PremiumsReceived"`
+	ClaimsPaid       float64 `json:"ClaimsPaid"`
+	RefundsPaid      float64 `json:"RefundsPaid"`
+	MaturitiesPaid   float64 `json:"MaturitiesPaid"`
+	SurrendersPaid   float64 `json:"SurrendersPaid"`
+	CommissionsPaid  float64 `json:"CommissionsPaid"`
+	OtherPayouts     float64 `json:"OtherPayouts"`
+	OtherReceipts    float64 `json:"OtherReceipts"`
+	// Retained is what the journal says the insurer keeps; it must equal Balance
+	Retained float64 `json:"Retained"`
+}
+
+// TrialBalance proves that premiums received equal payouts plus retained funds across all insurers,
+// and that the balances of every account on the ledger sum to zero
+type TrialBalance struct {
+	Companies       []CompanyBalance `json:"Companies"`
+	TotalPremiums   float64          `json:"TotalPremiums"`
+	TotalPayouts    float64          `json:"TotalPayouts"`
+	TotalRetained   float64          `json:"TotalRetained"`
+	CustomerFunds   float64          `json:"CustomerFunds"`
+	ExternalBalance float64          `json:"ExternalBalance"`
+	InTransit       float64          `json:"InTransit"`
+	AgentFunds      float64          `json:"AgentFunds"`
+	AccountsTotal   float64          `json:"AccountsTotal"`
+	Balanced        bool             `json:"Balanced"`
+}
+
+// GetCompanyBalance returns the treasury balance of an insurer with its receipts and payouts by type
+func (s *SmartContract) GetCompanyBalance(ctx contractapi.TransactionContextInterface, companyName string) (*CompanyBalance, error) {
+	ref := insurerAccountRef(companyName)
+
+	account, err := readAccount(ctx, ref.ID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, fmt.Errorf("company %s has no treasury account", companyName)
+	}
+
+	return s.companyBalance(ctx, account)
+}
+
+// GetTrialBalance checks every insurer's treasury against its journal and the ledger-wide double entry
+func (s *SmartContract) GetTrialBalance(ctx contractapi.TransactionContextInterface) (*TrialBalance, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	trial := TrialBalance{Companies: []CompanyBalance{}, Balanced: true}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var account Account
+		if err := json.Unmarshal(queryResponse.Value, &account); err != nil {
+			return nil, err
+		}
+
+		trial.AccountsTotal += account.Balance
+
+		switch account.OwnerType {
+		case CustomerAccount:
+			trial.CustomerFunds += account.Balance
+		case ExternalAccount:
+			trial.ExternalBalance += account.Balance
+		case ClearingAccount:
+			trial.InTransit += account.Balance
+		case AgentAccount:
+			trial.AgentFunds += account.Balance
+		case InsurerAccount:
+			company, err := s.companyBalance(ctx, &account)
+			if err != nil {
+				return nil, err
+			}
+
+			trial.Companies = append(trial.Companies, *company)
+			trial.TotalPremiums += company.PremiumsReceived
+			trial.TotalPayouts += company.ClaimsPaid + company.RefundsPaid + company.MaturitiesPaid + company.SurrendersPaid + company.CommissionsPaid + company.OtherPayouts
+			trial.TotalRetained += company.Balance
+
+			if math.Abs(company.Retained-company.Balance) > balanceTolerance {
+				trial.Balanced = false
+			}
+		}
+	}
+
+	// Premiums in must equal payouts plus retained funds, and double entry keeps the ledger total at zero
+	var otherReceipts float64
+	for _, company := range trial.Companies {
+		otherReceipts += company.OtherReceipts
+	}
+	if math.Abs(trial.TotalPremiums+otherReceipts-trial.TotalPayouts-trial.TotalRetained) > balanceTolerance {
+		trial.Balanced = false
+	}
+	if math.Abs(trial.AccountsTotal) > balanceTolerance {
+		trial.Balanced = false
+	}
+
+	return &trial, nil
+}
+
+// companyBalance rebuilds an insurer's receipts and payouts from the journal entries of its account
+func (s *SmartContract) companyBalance(ctx contractapi.TransactionContextInterface, account *Account) (*CompanyBalance, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(accountEntryObjectType, []string{account.ID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	company := CompanyBalance{
+		CompanyName: account.OwnerName,
+		AccountID:   account.ID,
+		Balance:     account.Balance,
+	}
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var entry JournalEntry
+		if err := json.Unmarshal(queryResponse.Value, &entry); err != nil {
+			return nil, err
+		}
+
+		if entry.CreditAccount == account.ID {
+			if entry.Type == PremiumEntry {
+				company.PremiumsReceived += entry.Amount
+			} else {
+				company.OtherReceipts += entry.Amount
+			}
+			continue
+		}
+
+		switch entry.Type {
+		case ClaimEntry:
+			company.ClaimsPaid += entry.Amount
+		case RefundEntry:
+			company.RefundsPaid += entry.Amount
+		case MaturityEntry:
+			company.MaturitiesPaid += entry.Amount
+		case SurrenderEntry:
+			company.SurrendersPaid += entry.Amount
+		case CommissionEntry:
+			company.CommissionsPaid += entry.Amount
+		default:
+			company.OtherPayouts += entry.Amount
+		}
+	}
+
+	company.Retained = company.PremiumsReceived + company.OtherReceipts - company.ClaimsPaid - company.RefundsPaid -
+		company.MaturitiesPaid - company.SurrendersPaid - company.CommissionsPaid - company.OtherPayouts
+
+	return &company, nil
+}